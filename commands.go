@@ -0,0 +1,725 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/altdesktop/playerbm/internal/cli"
+	"github.com/altdesktop/playerbm/internal/model"
+	"github.com/altdesktop/playerbm/internal/player"
+	"github.com/godbus/dbus/v5"
+	"github.com/kballard/go-shellquote"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// firstPlayer returns the player name given on the command line or the first
+// running player.
+func firstPlayer(bus *dbus.Conn, commandArgs []string) (string, error) {
+	if len(commandArgs) > 0 {
+		return commandArgs[0], nil
+	}
+
+	names, err := player.ListPlayers(bus)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", newCommandError("no players were found")
+	}
+	return names[0], nil
+}
+
+// bookmarkForArgs returns the bookmark for the url given on the command line
+// or the most recent bookmark.
+func bookmarkForArgs(db *sql.DB, policy *model.Policy, commandArgs []string) (*model.Bookmark, error) {
+	var url *model.XesamUrl
+	var err error
+
+	if len(commandArgs) > 0 {
+		url, err = parseUrlArg(commandArgs[0])
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		recent, err := model.GetMostRecentBookmark(db)
+		if err != nil {
+			return nil, err
+		}
+		if recent == nil {
+			return nil, newCommandError("no recent unfinished bookmarks found")
+		}
+		url = recent.Url
+	}
+
+	return model.GetBookmark(db, url, policy)
+}
+
+func handleChapters(args *cli.PbmCli, db *sql.DB) error {
+	if len(args.CommandArgs) > 0 && (args.CommandArgs[0] == "next" || args.CommandArgs[0] == "prev") {
+		bus, err := dbus.SessionBus()
+		if err != nil {
+			return err
+		}
+
+		name, err := firstPlayer(bus, args.CommandArgs[1:])
+		if err != nil {
+			return err
+		}
+
+		p := player.New(args, db, bus)
+		p.SetName(name)
+		err = p.EnsureBookmark()
+		if err != nil {
+			return err
+		}
+
+		delta := 1
+		if args.CommandArgs[0] == "prev" {
+			delta = -1
+		}
+		i, err := p.SeekChapter(delta)
+		if err != nil {
+			return newCommandError("%s", err.Error())
+		}
+
+		fmt.Printf("%s\n", p.Bookmark.ChapterName(i))
+		return nil
+	}
+
+	bookmark, err := bookmarkForArgs(db, args.Policy, args.CommandArgs)
+	if err != nil {
+		return err
+	}
+
+	if len(bookmark.Chapters) == 0 {
+		fmt.Fprintf(os.Stderr, "No chapters found for %s\n", bookmark.Url.ShellQuoted())
+		return nil
+	}
+
+	current := bookmark.ChapterIndex(bookmark.Position)
+	for i, chapter := range bookmark.Chapters {
+		marker := " "
+		if i == current {
+			marker = "*"
+		}
+		fmt.Printf("%s %9s  %s\n", marker, player.FormatPosition(chapter.Position), bookmark.ChapterName(i))
+	}
+
+	return nil
+}
+
+// formatChapter shows the chapter at the position with the time relative to
+// the start of the chapter.
+func formatChapter(bookmark *model.Bookmark, position int64) string {
+	i := bookmark.ChapterIndex(position)
+	if i == -1 {
+		return ""
+	}
+
+	relative := player.FormatPosition(position - bookmark.Chapters[i].Position)
+	if end := bookmark.ChapterEnd(i); end > bookmark.Chapters[i].Position {
+		relative = relative + "/" + player.FormatPosition(end-bookmark.Chapters[i].Position)
+	}
+
+	return fmt.Sprintf("%s (%s)", bookmark.ChapterName(i), relative)
+}
+
+func handleStatus(args *cli.PbmCli, db *sql.DB) error {
+	bus, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+
+	names := args.CommandArgs
+	if len(names) == 0 {
+		names, err = player.ListPlayers(bus)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		p := player.New(args, db, bus)
+		p.SetName(name)
+		err = p.EnsureBookmark()
+		if err != nil {
+			fmt.Printf("%s: %s\n", name, err.Error())
+			continue
+		}
+
+		position := player.FormatPosition(p.Position)
+		if p.Bookmark.Length > 0 {
+			position = position + "/" + player.FormatPosition(p.Bookmark.Length)
+		}
+
+		fmt.Printf("%s: %s %s %s\n", name, p.Status, position, displayUrl(p.Bookmark.Url))
+		if chapter := formatChapter(p.Bookmark, p.Position); len(chapter) > 0 {
+			fmt.Printf("    %s\n", chapter)
+		}
+	}
+
+	return nil
+}
+
+func handleSearch(args *cli.PbmCli, db *sql.DB) error {
+	if len(args.CommandArgs) == 0 {
+		return newCommandError("a query is required for the search command")
+	}
+
+	query := shellquote.Join(args.CommandArgs...)
+	if len(args.Tag) > 0 {
+		query = query + " " + shellquote.Join("tag:"+args.Tag)
+	}
+
+	bookmarks, err := model.Search(db, query)
+	if err != nil {
+		if searchErr, ok := err.(*model.SearchError); ok {
+			return newCommandError("%s", searchErr.Error())
+		}
+		return err
+	}
+
+	if len(bookmarks) == 0 {
+		fmt.Fprintf(os.Stderr, "No bookmarks found\n")
+		return nil
+	}
+
+	printBookmarks(bookmarks)
+	return nil
+}
+
+func handleNote(args *cli.PbmCli, db *sql.DB) error {
+	if len(args.CommandArgs) == 0 {
+		return newCommandError("a URL argument is required for the note command")
+	}
+
+	bookmark, err := bookmarkForArgs(db, args.Policy, args.CommandArgs[:1])
+	if err != nil {
+		return err
+	}
+
+	if len(args.CommandArgs) == 1 {
+		if len(bookmark.Notes) > 0 {
+			fmt.Printf("%s\n", bookmark.Notes)
+		}
+		return nil
+	}
+
+	bookmark.Notes = strings.Join(args.CommandArgs[1:], " ")
+	return bookmark.Save(db)
+}
+
+func handleTagRule(db *sql.DB, commandArgs []string) error {
+	if len(commandArgs) == 0 || commandArgs[0] == "list" {
+		rules, err := model.ListTagRules(db)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			fmt.Printf("%s\t%s\n", rule.Tag, rule.Prefix)
+		}
+		return nil
+	}
+
+	if len(commandArgs) != 3 {
+		return newCommandError("usage: tag rule add|remove TAG PATH")
+	}
+
+	prefix, err := filepath.Abs(commandArgs[2])
+	if err != nil {
+		return err
+	}
+	rule := model.TagRule{Tag: commandArgs[1], Prefix: prefix}
+
+	switch commandArgs[0] {
+	case "add":
+		return model.AddTagRule(db, rule)
+	case "remove":
+		return model.RemoveTagRule(db, rule)
+	}
+
+	return newCommandError("unknown tag rule command: %s", commandArgs[0])
+}
+
+func handleTag(args *cli.PbmCli, db *sql.DB) error {
+	if len(args.CommandArgs) == 0 || args.CommandArgs[0] == "list" {
+		if len(args.CommandArgs) > 1 {
+			bookmark, err := bookmarkForArgs(db, args.Policy, args.CommandArgs[1:])
+			if err != nil {
+				return err
+			}
+			for _, tag := range bookmark.Tags {
+				fmt.Printf("%s\n", tag)
+			}
+			return nil
+		}
+
+		tags, err := model.ListTags(db)
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			fmt.Printf("%s\t%d\n", tag.Name, tag.Count)
+		}
+		return nil
+	}
+
+	subcommand := args.CommandArgs[0]
+	if subcommand == "rule" {
+		return handleTagRule(db, args.CommandArgs[1:])
+	}
+
+	if subcommand != "add" && subcommand != "remove" {
+		return newCommandError("unknown tag command: %s", subcommand)
+	}
+
+	if len(args.CommandArgs) < 3 {
+		return newCommandError("usage: tag %s TAG URL…", subcommand)
+	}
+
+	tag := args.CommandArgs[1]
+	for _, arg := range args.CommandArgs[2:] {
+		bookmark, err := bookmarkForArgs(db, args.Policy, []string{arg})
+		if err != nil {
+			return err
+		}
+
+		if subcommand == "add" {
+			err = bookmark.AddTag(db, tag)
+		} else {
+			err = bookmark.RemoveTag(db, tag)
+		}
+		if policyErr, ok := err.(*model.PolicyError); ok {
+			return newCommandError("%s: %s", arg, policyErr.Error())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func handleBook(args *cli.PbmCli, db *sql.DB) error {
+	var dir string
+	if len(args.CommandArgs) > 0 {
+		dir = args.CommandArgs[0]
+	} else {
+		recent, err := model.GetMostRecentTaggedBookmark(db, args.Tag)
+		if err != nil {
+			return err
+		}
+		if recent == nil {
+			return newCommandError("no recent unfinished bookmarks found")
+		}
+		if recent.Url.Scheme() != "file" {
+			return newCommandError("the last saved bookmark is not a local file: %s", recent.Url.String())
+		}
+		dir = filepath.Dir(recent.Url.UnescapedPath())
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	book, err := model.GetBook(db, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newCommandError("directory does not exist: %s", dir)
+		}
+		return err
+	}
+
+	if len(book.Files) == 0 {
+		fmt.Fprintf(os.Stderr, "No media files found in %s\n", dir)
+		return nil
+	}
+
+	for i, file := range book.Files {
+		marker := " "
+		if i == book.Current {
+			marker = "*"
+		}
+
+		var position int64
+		if file.Bookmark != nil {
+			position = file.Bookmark.Position
+			if file.Bookmark.Finished == 1 {
+				position = file.Length
+			}
+		}
+		length := "?"
+		if file.Length > 0 {
+			length = player.FormatPosition(file.Length)
+		}
+
+		name := filepath.Base(file.Url.UnescapedPath())
+		fmt.Printf("%s %s  %s/%s\n", marker, name, player.FormatPosition(position), length)
+	}
+
+	current := "finished"
+	if book.Current != -1 {
+		current = fmt.Sprintf("file %d of %d", book.Current+1, len(book.Files))
+	}
+	fmt.Printf("%s: %.0f%% (%s/%s), %s\n", filepath.Base(dir), book.Progress()*100,
+		player.FormatPosition(book.Position()), player.FormatPosition(book.Length()), current)
+
+	return nil
+}
+
+// parseUrlArg parses a url given on the command line with file paths made
+// absolute so they match the urls players give.
+func parseUrlArg(arg string) (*model.XesamUrl, error) {
+	url, err := model.ParseXesamUrl(arg)
+	if err != nil {
+		return nil, newCommandError("could not parse url: %s", arg)
+	}
+	if url.Scheme() != "file" {
+		return url, nil
+	}
+	path, err := filepath.Abs(url.UnescapedPath())
+	if err != nil {
+		return nil, err
+	}
+	return model.FileUrl(path), nil
+}
+
+func handleQueue(args *cli.PbmCli, db *sql.DB) error {
+	if len(args.CommandArgs) == 0 || args.CommandArgs[0] == "ls" {
+		urls, err := model.ListQueue(db)
+		if err != nil {
+			return err
+		}
+		for i, url := range urls {
+			fmt.Printf("%d  %s\n", i+1, displayUrl(url))
+		}
+		return nil
+	}
+
+	subcommand := args.CommandArgs[0]
+	switch subcommand {
+	case "add", "rm":
+		if len(args.CommandArgs) < 2 {
+			return newCommandError("usage: queue %s URL…", subcommand)
+		}
+		for _, arg := range args.CommandArgs[1:] {
+			url, err := parseUrlArg(arg)
+			if err != nil {
+				return err
+			}
+			if subcommand == "add" {
+				err = model.QueueAdd(db, url)
+			} else {
+				err = model.QueueRemove(db, url)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "mv":
+		if len(args.CommandArgs) != 3 {
+			return newCommandError("usage: queue mv URL POSITION")
+		}
+		url, err := parseUrlArg(args.CommandArgs[1])
+		if err != nil {
+			return err
+		}
+		position, err := strconv.Atoi(args.CommandArgs[2])
+		if err != nil || position < 1 {
+			return newCommandError("position must be a number from 1, got: %s", args.CommandArgs[2])
+		}
+		err = model.QueueMove(db, url, position-1)
+		if queueErr, ok := err.(*model.QueueError); ok {
+			return newCommandError("%s", queueErr.Error())
+		}
+		return err
+	}
+
+	return newCommandError("unknown queue command: %s", subcommand)
+}
+
+func handleSessionResume(args *cli.PbmCli, db *sql.DB, session *model.Session) error {
+	if len(session.PlayerCmd) == 0 {
+		return newCommandError("session %d was not started with a player command", session.Id)
+	}
+
+	bus, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+
+	args.PlayerCmd = session.PlayerCmd
+	supervisor := newSupervisor(bus)
+	p := player.New(args, db, bus)
+	supervisor.Go(p, p.RunCmd)
+	supervise(supervisor)
+	return nil
+}
+
+func handleSession(args *cli.PbmCli, db *sql.DB) error {
+	if len(args.CommandArgs) == 0 || args.CommandArgs[0] == "ls" {
+		sessions, err := model.ListSessions(db)
+		if err != nil {
+			return err
+		}
+		for _, session := range sessions {
+			current := "-"
+			if url := session.CurrentUrl(); url != nil {
+				current = displayUrl(url)
+			}
+			fmt.Printf("%d  %d/%d  %s  %s\n", session.Id, session.Current+1, len(session.Urls),
+				player.FormatPosition(session.Position), current)
+		}
+		return nil
+	}
+
+	subcommand := args.CommandArgs[0]
+	if subcommand != "resume" && subcommand != "rm" {
+		return newCommandError("unknown session command: %s", subcommand)
+	}
+
+	var session *model.Session
+	if len(args.CommandArgs) > 1 {
+		id, err := strconv.ParseInt(args.CommandArgs[1], 10, 64)
+		if err != nil {
+			return newCommandError("session id must be a number, got: %s", args.CommandArgs[1])
+		}
+		session, err = model.GetSessionById(db, id)
+		if err != nil {
+			return err
+		}
+	} else if subcommand == "resume" {
+		sessions, err := model.ListSessions(db)
+		if err != nil {
+			return err
+		}
+		if len(sessions) > 0 {
+			session = &sessions[0]
+		}
+	} else {
+		return newCommandError("usage: session rm ID")
+	}
+
+	if session == nil {
+		return newCommandError("no session found")
+	}
+
+	if subcommand == "rm" {
+		return session.Delete(db)
+	}
+	return handleSessionResume(args, db, session)
+}
+
+// parseSegment parses the START and END arguments of a segment.
+func parseSegment(start string, end string) (model.Segment, error) {
+	segment := model.Segment{}
+	var err error
+	segment.Start, err = player.ParsePosition(start)
+	if err != nil {
+		return segment, newCommandError("%s", err.Error())
+	}
+	segment.End, err = player.ParsePosition(end)
+	if err != nil {
+		return segment, newCommandError("%s", err.Error())
+	}
+	if segment.End <= segment.Start {
+		return segment, newCommandError("the end of a segment must be after its start")
+	}
+	return segment, nil
+}
+
+func printSegment(segment model.Segment) {
+	fmt.Printf("%s\t%s\n", player.FormatPosition(segment.Start), player.FormatPosition(segment.End))
+}
+
+func handleSkip(args *cli.PbmCli, db *sql.DB) error {
+	if len(args.CommandArgs) == 0 || args.CommandArgs[0] == "ls" {
+		if len(args.CommandArgs) > 1 {
+			bookmark, err := bookmarkForArgs(db, args.Policy, args.CommandArgs[1:])
+			if err != nil {
+				return err
+			}
+			segments, err := bookmark.SkipSegments(db)
+			if err != nil {
+				return err
+			}
+			for _, segment := range segments {
+				printSegment(segment)
+			}
+			return nil
+		}
+
+		segments, err := model.ListDirSegments(db)
+		if err != nil {
+			return err
+		}
+		for _, segment := range segments {
+			fmt.Printf("%s\t", segment.Dir)
+			printSegment(segment.Segment)
+		}
+		return nil
+	}
+
+	subcommand := args.CommandArgs[0]
+	if subcommand != "add" && subcommand != "rm" {
+		return newCommandError("unknown skip command: %s", subcommand)
+	}
+	if len(args.CommandArgs) != 4 {
+		return newCommandError("usage: skip %s PATH START END", subcommand)
+	}
+
+	segment, err := parseSegment(args.CommandArgs[2], args.CommandArgs[3])
+	if err != nil {
+		return err
+	}
+
+	path := args.CommandArgs[1]
+	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+		dir, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		dirSegment := model.DirSegment{Dir: dir, Segment: segment}
+		if subcommand == "add" {
+			return model.AddDirSegment(db, dirSegment)
+		}
+		return model.RemoveDirSegment(db, dirSegment)
+	}
+
+	bookmark, err := bookmarkForArgs(db, args.Policy, []string{path})
+	if err != nil {
+		return err
+	}
+	if subcommand == "add" {
+		err = bookmark.AddSegment(db, segment)
+		if policyErr, ok := err.(*model.PolicyError); ok {
+			return newCommandError("%s: %s", path, policyErr.Error())
+		}
+		return err
+	}
+	return bookmark.RemoveSegment(db, segment)
+}
+
+func handleGaps(args *cli.PbmCli, db *sql.DB) error {
+	bookmark, err := bookmarkForArgs(db, args.Policy, args.CommandArgs)
+	if err != nil {
+		return err
+	}
+
+	if bookmark.Length <= 0 {
+		return newCommandError("the length of %s is not known", bookmark.Url.ShellQuoted())
+	}
+
+	gaps := bookmark.Gaps()
+	if len(gaps) == 0 {
+		fmt.Fprintf(os.Stderr, "All of %s was listened to\n", bookmark.Url.ShellQuoted())
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%.0f%% of %s was listened to\n", bookmark.Coverage(), bookmark.Url.ShellQuoted())
+	for _, gap := range gaps {
+		fmt.Printf("%9s  %9s  (%s)\n", player.FormatPosition(gap.Start), player.FormatPosition(gap.End),
+			player.FormatPosition(gap.End-gap.Start))
+	}
+
+	return nil
+}
+
+func handleSettings(args *cli.PbmCli, db *sql.DB) error {
+	if len(args.CommandArgs) == 0 {
+		return newCommandError("settings: expected a subcommand")
+	}
+	subcommand := args.CommandArgs[0]
+
+	switch subcommand {
+	case "ls":
+		bookmark, err := bookmarkForArgs(db, args.Policy, args.CommandArgs[1:])
+		if err != nil {
+			return err
+		}
+		if len(bookmark.Settings) == 0 {
+			fmt.Fprintf(os.Stderr, "No settings saved for %s\n", bookmark.Url.ShellQuoted())
+			return nil
+		}
+		for _, setting := range bookmark.Settings {
+			pinned := ""
+			if setting.Pinned {
+				pinned = " (pinned)"
+			}
+			fmt.Printf("%-8s %s%s\n", setting.Name, setting.Value, pinned)
+		}
+		return nil
+	case "set":
+		if len(args.CommandArgs) != 4 {
+			return newCommandError("usage: settings set URL NAME VALUE")
+		}
+		bookmark, err := bookmarkForArgs(db, args.Policy, args.CommandArgs[1:2])
+		if err != nil {
+			return err
+		}
+		err = bookmark.PinSetting(db, args.CommandArgs[2], args.CommandArgs[3])
+		if settingErr, ok := err.(*model.SettingError); ok {
+			return newCommandError("%s", settingErr.Error())
+		}
+		if policyErr, ok := err.(*model.PolicyError); ok {
+			return newCommandError("%s: %s", args.CommandArgs[1], policyErr.Error())
+		}
+		return err
+	case "rm":
+		if len(args.CommandArgs) != 3 {
+			return newCommandError("usage: settings rm URL NAME")
+		}
+		bookmark, err := bookmarkForArgs(db, args.Policy, args.CommandArgs[1:2])
+		if err != nil {
+			return err
+		}
+		return bookmark.RemoveSetting(db, args.CommandArgs[2])
+	}
+
+	return newCommandError("unknown settings command: %s", subcommand)
+}
+
+type CommandError struct {
+	err string
+}
+
+func (e *CommandError) Error() string {
+	return e.err
+}
+
+func newCommandError(format string, args ...interface{}) *CommandError {
+	return &CommandError{err: fmt.Sprintf(format, args...)}
+}
+
+func runCommand(args *cli.PbmCli, db *sql.DB) error {
+	switch args.Command {
+	case "chapters":
+		return handleChapters(args, db)
+	case "status":
+		return handleStatus(args, db)
+	case "search":
+		return handleSearch(args, db)
+	case "note":
+		return handleNote(args, db)
+	case "tag":
+		return handleTag(args, db)
+	case "book":
+		return handleBook(args, db)
+	case "queue":
+		return handleQueue(args, db)
+	case "session":
+		return handleSession(args, db)
+	case "skip":
+		return handleSkip(args, db)
+	case "gaps":
+		return handleGaps(args, db)
+	case "settings":
+		return handleSettings(args, db)
+	}
+
+	return newCommandError("unknown command: %s", args.Command)
+}
@@ -16,13 +16,40 @@ type PbmCli struct {
 	VersionFlag       bool
 	ResumeFlag        bool
 	ResumeUrl         *model.XesamUrl
+	Player            string
+	OpenIn            string
 	SaveFlag          bool
 	SavePlayers       string
+	AttachFlag        bool
+	AttachPlayer      string
 	DeleteFlag        bool
 	DeleteUrl         *model.XesamUrl
+	SectionStartFlag  bool
+	AutoAdvanceFlag   bool
+	Tag               string
+	Command           string
+	CommandArgs       []string
+	Policy            *model.Policy
+}
+
+// Commands are given in place of the PLAYER_COMMAND and take the rest of the
+// arguments.
+var Commands = []string{
+	"chapters",
+	"status",
+	"search",
+	"note",
+	"tag",
+	"book",
+	"queue",
+	"session",
+	"skip",
+	"gaps",
+	"settings",
 }
 
 const HelpString = `playerbm [OPTION…] PLAYER_COMMAND
+playerbm [OPTION…] COMMAND [ARG…]
 
 Description:
     playerbm is a utility that saves your place when you exit the player or
@@ -43,13 +70,83 @@ Options:
    -l, --list-bookmarks  List all bookmarks and exit.
    -L, --list-players    List all running players that can be controlled.
    -r, --resume=[URL]    Launch a player and resume playing URL from the last
-                         saved bookmark and begin managing bookmarks. (default:
-                         file of the last saved bookmark)
+                         saved bookmark and begin managing bookmarks. If URL is
+                         a directory, resume its current file. (default: file
+                         of the last saved bookmark or the head of the queue)
+   -p, --player={CMD}    The player command to resume with. The url replaces {}
+                         or is added to the end. (default: the player that
+                         last opened the bookmark, the player for its type
+                         in the config or else xdg-open)
+   -o, --open-in={PLAYER}
+                         Resume in the running player with the name. (default:
+                         the player of the bookmark or the config if it is
+                         running and supports the url)
+   -A, --attach={PLAYER} Manage players that are already running in a comma
+                         separated list until they exit, restoring the
+                         bookmarks of their current files.
    -s, --save=[PLAYER]   Save bookmarks for the running players in a comma
                          separated list. (default: all running players)
    -d, --delete={URL}    Delete the bookmark for the given url.
+   -t, --tag={TAG}       Only list, search or resume bookmarks with the tag.
+   -b, --section-start   When restoring a bookmark, rewind to the start of the
+                         current chapter or cue sheet track.
+   -a, --auto-advance    When a file finishes, open the next item in the queue
+                         if it was queued or else the next file in its
+                         directory and resume it from its bookmark.
    -h, --help            Show help.
-   -v, --version         Print the version.` + "\n"
+   -v, --version         Print the version.
+
+Commands:
+   chapters [URL]        List the chapters of URL. (default: file of the last
+                         saved bookmark)
+   chapters next|prev [PLAYER]
+                         Jump to the next or previous chapter in a running
+                         player. (default: the first running player)
+   status [PLAYER…]      Show the position and chapter of running players.
+                         (default: all running players)
+   search QUERY…         Search bookmarks by path, title, artist, album and
+                         notes. Words of the form FIELD:WORD only match that
+                         field and finished:yes or finished:no filters on
+                         whether the bookmark is finished.
+   note URL [TEXT…]      Set the notes of the bookmark for URL or print them
+                         if no TEXT is given.
+   tag add|remove TAG URL…
+                         Add or remove the bookmarks for URL to the collection
+                         named TAG.
+   tag list [URL]        List all tags or the tags of the bookmark for URL.
+   tag rule add|remove TAG PATH
+                         Add or remove a rule to tag new bookmarks for files
+                         under PATH.
+   tag rule list         List the rules to tag new bookmarks.
+   book [DIR]            Show the progress through the media files in DIR as
+                         one book. (default: directory of the last saved
+                         bookmark)
+   queue add|rm URL…     Add URL to the end of the queue or remove it. Items
+                         leave the queue when their bookmark is finished.
+   queue mv URL POSITION Move URL to POSITION in the queue.
+   queue ls              List the queue.
+   session ls            List the saved playlists with their current track and
+                         position.
+   session resume [ID]   Run the player command of the playlist again and go
+                         back to its track and position. (default: the last
+                         playlist)
+   session rm ID         Delete the saved playlist.
+   skip add|rm PATH START END
+                         Add or remove a segment to skip while playing the
+                         file at PATH, or the files under PATH that have no
+                         segments of their own if it is a directory. Times
+                         are in seconds or [H:]M:SS. Seeking back into a
+                         skipped segment plays it once.
+   skip ls [URL]         List the segments to skip in URL or the segments of
+                         all directories.
+   gaps [URL]            List the parts of URL that were not listened to.
+                         (default: the last saved bookmark)
+   settings ls [URL]     List the rate, volume, loop and shuffle settings that
+                         are restored with the bookmark for URL.
+   settings set URL NAME VALUE
+                         Always restore the setting NAME with VALUE for URL
+                         instead of the last value the player had.
+   settings rm URL NAME  Forget the setting NAME for URL.` + "\n"
 
 const VersionString = "v0.0.1\n"
 
@@ -100,7 +197,7 @@ func parseStringFlag(arg string, flag StringFlag) (bool, bool, error) {
 
 	if strings.HasPrefix(arg, flag.Short+"=") || strings.HasPrefix(arg, flag.Long+"=") {
 		*flag.Present = true
-		*flag.ArgValue = strings.Split(arg, "=")[1]
+		*flag.ArgValue = strings.SplitN(arg, "=", 2)[1]
 		return true, true, nil
 	}
 
@@ -124,14 +221,23 @@ func ParseArgs(args []string) (*PbmCli, error) {
 		BoolFlag{Short: "-h", Long: "--help", Value: &cli.HelpFlag},
 		BoolFlag{Short: "-l", Long: "--list-bookmarks", Value: &cli.ListBookmarksFlag},
 		BoolFlag{Short: "-L", Long: "--list-players", Value: &cli.ListPlayersFlag},
+		BoolFlag{Short: "-b", Long: "--section-start", Value: &cli.SectionStartFlag},
+		BoolFlag{Short: "-a", Long: "--auto-advance", Value: &cli.AutoAdvanceFlag},
 	}
 
 	var resumeUrl string
 	var deleteUrl string
+	var tagFlag bool
+	var playerFlag bool
+	var openInFlag bool
 	stringFlags := []StringFlag{
 		StringFlag{Short: "-s", Long: "--save", Present: &cli.SaveFlag, ArgValue: &cli.SavePlayers},
 		StringFlag{Short: "-r", Long: "--resume", Present: &cli.ResumeFlag, ArgValue: &resumeUrl},
 		StringFlag{Short: "-d", Long: "--delete", Present: &cli.DeleteFlag, ArgValue: &deleteUrl},
+		StringFlag{Short: "-t", Long: "--tag", Present: &tagFlag, ArgValue: &cli.Tag},
+		StringFlag{Short: "-p", Long: "--player", Present: &playerFlag, ArgValue: &cli.Player},
+		StringFlag{Short: "-o", Long: "--open-in", Present: &openInFlag, ArgValue: &cli.OpenIn},
+		StringFlag{Short: "-A", Long: "--attach", Present: &cli.AttachFlag, ArgValue: &cli.AttachPlayer},
 	}
 
 	firstPlayerArg := -1
@@ -203,8 +309,45 @@ func ParseArgs(args []string) (*PbmCli, error) {
 		}
 	}
 
+	if tagFlag && len(cli.Tag) == 0 {
+		return nil, newCliError("a TAG argument is required for the tag flag")
+	}
+
+	if playerFlag && len(cli.Player) == 0 {
+		return nil, newCliError("a PLAYER argument is required for the player flag")
+	}
+	if playerFlag && !cli.ResumeFlag {
+		return nil, newCliError("the player flag can only be used with the resume flag")
+	}
+
+	if openInFlag && len(cli.OpenIn) == 0 {
+		return nil, newCliError("a PLAYER argument is required for the open-in flag")
+	}
+	if openInFlag && !cli.ResumeFlag {
+		return nil, newCliError("the open-in flag can only be used with the resume flag")
+	}
+	if openInFlag && playerFlag {
+		return nil, newCliError("the open-in flag cannot be used with the player flag")
+	}
+
+	if cli.AttachFlag && len(cli.AttachPlayer) == 0 {
+		return nil, newCliError("a PLAYER argument is required for the attach flag")
+	}
+	if cli.AttachFlag && (cli.ResumeFlag || firstPlayerArg != -1) {
+		return nil, newCliError("the attach flag cannot be used with the resume flag or a player command")
+	}
+
 	if firstPlayerArg != -1 {
-		cli.PlayerCmd = shellquote.Join(args[firstPlayerArg:]...)
+		for _, command := range Commands {
+			if args[firstPlayerArg] == command {
+				cli.Command = command
+				cli.CommandArgs = args[firstPlayerArg+1:]
+				break
+			}
+		}
+		if len(cli.Command) == 0 {
+			cli.PlayerCmd = shellquote.Join(args[firstPlayerArg:]...)
+		}
 	}
 
 	// TODO: argument validation
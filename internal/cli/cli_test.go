@@ -106,5 +106,50 @@ func TestFileWithSpaces(t *testing.T) {
 	require.Equal(t, "/Comedy - Ep.#3 A Secret Society (w_ Jason Ritter, Craig Cackowski, Amanda Lund, Chris Tallman)-9HuAXgbdFx4.opus", cli.DeleteUrl.UnescapedPath())
 }
 
+func TestCommands(t *testing.T) {
+	cli, err := ParseArgs([]string{"playerbm", "chapters", "next", "mpv"})
+	require.NoError(t, err)
+	require.Equal(t, "chapters", cli.Command)
+	require.Equal(t, []string{"next", "mpv"}, cli.CommandArgs)
+	require.Equal(t, "", cli.PlayerCmd)
+
+	cli, err = ParseArgs([]string{"playerbm", "--tag", "commute", "-l"})
+	require.NoError(t, err)
+	require.Equal(t, "commute", cli.Tag)
+	require.True(t, cli.ListBookmarksFlag)
+
+	_, err = ParseArgs([]string{"playerbm", "--tag"})
+	require.Error(t, err)
+
+	cli, err = ParseArgs([]string{"playerbm", "--resume", "--player=mpv --speed=1.5 {}"})
+	require.NoError(t, err)
+	require.True(t, cli.ResumeFlag)
+	require.Equal(t, "mpv --speed=1.5 {}", cli.Player)
+
+	_, err = ParseArgs([]string{"playerbm", "--player", "vlc", "-l"})
+	require.Error(t, err, "The player flag should only be used to resume")
+
+	cli, err = ParseArgs([]string{"playerbm", "-r", "--open-in", "vlc"})
+	require.NoError(t, err)
+	require.Equal(t, "vlc", cli.OpenIn)
+	require.Equal(t, "", cli.Player, "A running player should not be taken for a player command")
+
+	_, err = ParseArgs([]string{"playerbm", "-r", "--open-in=vlc", "--player=mpv"})
+	require.Error(t, err)
+
+	cli, err = ParseArgs([]string{"playerbm", "--attach", "mpv"})
+	require.NoError(t, err)
+	require.True(t, cli.AttachFlag)
+	require.Equal(t, "mpv", cli.AttachPlayer)
+
+	_, err = ParseArgs([]string{"playerbm", "--attach=mpv", "mpv", "book.mp3"})
+	require.Error(t, err, "A player cannot be attached to and launched at once")
+
+	cli, err = ParseArgs([]string{"playerbm", "mpv", "chapters"})
+	require.NoError(t, err)
+	require.Equal(t, "", cli.Command)
+	require.Equal(t, "mpv chapters", cli.PlayerCmd)
+}
+
 // TODO
 // func TestCliBadPath(t *testing.T) {}
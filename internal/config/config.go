@@ -0,0 +1,135 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/kyoh86/xdg"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// The config file is made of sections that start with a [name] line followed
+// by key = value lines. Keys before the first section are in the section with
+// an empty name. Lines that start with # or ; are comments.
+
+type Section struct {
+	Name   string
+	Values map[string]string
+}
+
+type Config struct {
+	Sections []*Section
+}
+
+type ConfigError struct {
+	err  string
+	Line int
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.err)
+}
+
+func Parse(r io.Reader) (*Config, error) {
+	config := Config{}
+	section := &Section{Values: map[string]string{}}
+	config.Sections = append(config.Sections, section)
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		if len(text) == 0 || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, &ConfigError{err: "section name is missing ]", Line: line}
+			}
+			name := strings.TrimSpace(text[1 : len(text)-1])
+			section = &Section{Name: name, Values: map[string]string{}}
+			config.Sections = append(config.Sections, section)
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return nil, &ConfigError{err: fmt.Sprintf("expected key = value, got: %s", text), Line: line}
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		if len(key) == 0 {
+			return nil, &ConfigError{err: "key is empty", Line: line}
+		}
+		section.Values[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Path is the location of the config file.
+func Path() string {
+	return path.Join(xdg.ConfigHome(), "playerbm", "config")
+}
+
+// Load reads the config file. A missing file is an empty config.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Section returns the last section with the name or nil if there is none.
+func (config *Config) Section(name string) *Section {
+	for i := len(config.Sections) - 1; i >= 0; i-- {
+		if config.Sections[i].Name == name {
+			return config.Sections[i]
+		}
+	}
+	return nil
+}
+
+// SectionsWithPrefix returns the sections with names of the form "prefix arg"
+// in order.
+func (config *Config) SectionsWithPrefix(prefix string) []*Section {
+	sections := []*Section{}
+	for _, section := range config.Sections {
+		if strings.HasPrefix(section.Name, prefix+" ") {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// Arg is the part of the section name after the prefix.
+func (section *Section) Arg() string {
+	parts := strings.SplitN(section.Name, " ", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+func (section *Section) Get(key string) (string, bool) {
+	if section == nil {
+		return "", false
+	}
+	value, ok := section.Values[key]
+	return value, ok
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	config, err := Parse(strings.NewReader(`
+# comment
+global = yes
+
+[dir ~/podcasts]
+intro = 0:45
+Outro=2:00
+
+[dir ~/movies]
+; another comment
+min-length = 10
+`))
+	require.NoError(t, err)
+
+	value, ok := config.Section("").Get("global")
+	require.True(t, ok)
+	require.Equal(t, "yes", value)
+
+	dirs := config.SectionsWithPrefix("dir")
+	require.Len(t, dirs, 2)
+	require.Equal(t, "~/podcasts", dirs[0].Arg())
+	value, ok = dirs[0].Get("outro")
+	require.True(t, ok, "Keys should not be case sensitive")
+	require.Equal(t, "2:00", value)
+
+	_, ok = config.Section("nothing").Get("intro")
+	require.False(t, ok, "A missing section should not have values")
+
+	_, err = Parse(strings.NewReader("[dir ~/podcasts]\nintro\n"))
+	require.Error(t, err)
+	require.Equal(t, 2, err.(*ConfigError).Line)
+}
@@ -0,0 +1,246 @@
+package media
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// cueFields splits a line of a cue sheet into its fields, keeping quoted
+// strings together.
+func cueFields(line string) []string {
+	fields := []string{}
+	var field strings.Builder
+	inQuotes := false
+	hasField := false
+
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			hasField = true
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if hasField {
+				fields = append(fields, field.String())
+				field.Reset()
+				hasField = false
+			}
+		default:
+			field.WriteRune(c)
+			hasField = true
+		}
+	}
+	if hasField {
+		fields = append(fields, field.String())
+	}
+
+	return fields
+}
+
+// parseCueTime parses a time in the mm:ss:ff format where there are 75
+// frames in a second.
+func parseCueTime(value string) (int64, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	numbers := [3]int64{}
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		numbers[i] = n
+	}
+	return (numbers[0]*60+numbers[1])*1000000 + numbers[2]*1000000/75, true
+}
+
+func decodeCue(data []byte) string {
+	if utf8.Valid(data) {
+		return strings.TrimPrefix(string(data), "\ufeff")
+	}
+	// cue sheets that are not utf-8 are usually latin1
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+type cueSheet struct {
+	files map[string][]Chapter
+	order []string
+}
+
+func parseCueSheet(text string) *cueSheet {
+	sheet := cueSheet{files: map[string][]Chapter{}}
+	file := ""
+	var track *Chapter
+	hasIndex := false
+
+	addTrack := func() {
+		if track != nil && hasIndex {
+			sheet.files[file] = append(sheet.files[file], *track)
+		}
+		track = nil
+		hasIndex = false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		fields := cueFields(strings.TrimSpace(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "FILE":
+			addTrack()
+			if len(fields) > 1 {
+				file = fields[1]
+				sheet.order = append(sheet.order, file)
+			}
+		case "TRACK":
+			addTrack()
+			track = &Chapter{}
+		case "TITLE":
+			if track != nil && len(fields) > 1 {
+				track.Title = fields[1]
+			}
+		case "INDEX":
+			if track == nil || len(fields) < 3 {
+				continue
+			}
+			start, ok := parseCueTime(fields[2])
+			if !ok {
+				continue
+			}
+			// index 01 is the start of the track and index 00 is the
+			// pregap before it
+			if fields[1] == "01" || fields[1] == "1" || !hasIndex {
+				track.Start = start
+				hasIndex = true
+			}
+		}
+	}
+	addTrack()
+
+	return &sheet
+}
+
+// tracksFor returns the tracks of the sheet for the audio file at path.
+func (sheet *cueSheet) tracksFor(path string) ([]Chapter, bool) {
+	base := filepath.Base(path)
+	for _, file := range sheet.order {
+		if filepath.Base(filepath.FromSlash(strings.Replace(file, "\\", "/", -1))) == base {
+			return sheet.files[file], true
+		}
+	}
+
+	if len(sheet.order) == 1 {
+		// a lone FILE entry is assumed to be for the file next to it even if
+		// it was renamed
+		return sheet.files[sheet.order[0]], false
+	}
+
+	return nil, false
+}
+
+// ReadCueSheet returns the tracks in the cue sheet that belong to the audio
+// file at audioPath.
+func ReadCueSheet(cuePath string, audioPath string) ([]Chapter, error) {
+	data, err := ioutil.ReadFile(cuePath)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks, _ := parseCueSheet(decodeCue(data)).tracksFor(audioPath)
+	return tracks, nil
+}
+
+// FindCueSheet looks for a cue sheet for the audio file at audioPath. This is
+// either a sibling file with the same name and a .cue extension or a cue
+// sheet in the same directory that references the audio file. An empty
+// string is returned if there is none.
+func FindCueSheet(audioPath string) (string, error) {
+	ext := filepath.Ext(audioPath)
+	candidates := []string{
+		strings.TrimSuffix(audioPath, ext) + ".cue",
+		audioPath + ".cue",
+	}
+	for _, candidate := range candidates {
+		if stat, err := os.Stat(candidate); err == nil && stat.Mode().IsRegular() {
+			return candidate, nil
+		}
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(audioPath))
+	if err != nil {
+		return "", err
+	}
+
+	for _, file := range files {
+		if !file.Mode().IsRegular() || !strings.EqualFold(filepath.Ext(file.Name()), ".cue") {
+			continue
+		}
+		cuePath := filepath.Join(filepath.Dir(audioPath), file.Name())
+		data, err := ioutil.ReadFile(cuePath)
+		if err != nil {
+			continue
+		}
+		if _, referenced := parseCueSheet(decodeCue(data)).tracksFor(audioPath); referenced {
+			return cuePath, nil
+		}
+	}
+
+	return "", nil
+}
+
+// CueSheetsMtime is the latest mtime of the cue sheets in the directory of
+// the audio file and of the directory itself, or 0 if there are no cue
+// sheets. The cue sheets only need to be looked through again when it
+// changes. Only the names in the directory are read.
+func CueSheetsMtime(audioPath string) (int64, error) {
+	dirPath := filepath.Dir(audioPath)
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+
+	var mtime int64
+	for _, name := range names {
+		if !strings.EqualFold(filepath.Ext(name), ".cue") {
+			continue
+		}
+		stat, err := os.Stat(filepath.Join(dirPath, name))
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+		if cueMtime := stat.ModTime().UnixNano(); cueMtime > mtime {
+			mtime = cueMtime
+		}
+	}
+	if mtime == 0 {
+		return 0, nil
+	}
+
+	// a cue sheet was removed or renamed
+	stat, err := dir.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if dirMtime := stat.ModTime().UnixNano(); dirMtime > mtime {
+		mtime = dirMtime
+	}
+	return mtime, nil
+}
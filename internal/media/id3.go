@@ -0,0 +1,267 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// The largest tag that is read for its chapters. Tags can claim up to 256MB
+// and the big ones are mostly pictures.
+const maxID3Size = 16 << 20
+
+type id3Frame struct {
+	id   string
+	data []byte
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// removeUnsync reverses the unsynchronisation scheme which inserts a zero
+// byte after every 0xff.
+func removeUnsync(data []byte) []byte {
+	return bytes.Replace(data, []byte{0xff, 0x00}, []byte{0xff}, -1)
+}
+
+func parseID3Frames(data []byte, major byte) []id3Frame {
+	frames := []id3Frame{}
+
+	for len(data) >= 10 {
+		if data[0] == 0 {
+			// padding
+			break
+		}
+
+		id := string(data[:4])
+		var size int
+		if major == 4 {
+			size = syncsafe(data[4:8])
+		} else {
+			size = int(binary.BigEndian.Uint32(data[4:8]))
+		}
+		flags := data[8:10]
+		data = data[10:]
+
+		if size < 0 || size > len(data) {
+			break
+		}
+
+		body := data[:size]
+		data = data[size:]
+
+		if major == 4 {
+			if flags[1]&0x0c != 0 {
+				// compressed or encrypted
+				continue
+			}
+			if flags[1]&0x01 != 0 {
+				// data length indicator
+				if len(body) < 4 {
+					continue
+				}
+				body = body[4:]
+			}
+			if flags[1]&0x02 != 0 {
+				body = removeUnsync(body)
+			}
+		} else if flags[1]&0xc0 != 0 {
+			// compressed or encrypted
+			continue
+		}
+
+		frames = append(frames, id3Frame{id: id, data: body})
+	}
+
+	return frames
+}
+
+// cString splits a null terminated latin1 string off the front of data.
+func cString(data []byte) (string, []byte) {
+	i := bytes.IndexByte(data, 0)
+	if i == -1 {
+		return string(data), nil
+	}
+	return string(data[:i]), data[i+1:]
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeID3Text(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	var text string
+	encoding, data := data[0], data[1:]
+	switch encoding {
+	case 0:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	case 1:
+		if len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe {
+			text = decodeUTF16(data[2:], binary.LittleEndian)
+		} else if len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff {
+			text = decodeUTF16(data[2:], binary.BigEndian)
+		} else {
+			text = decodeUTF16(data, binary.LittleEndian)
+		}
+	case 2:
+		text = decodeUTF16(data, binary.BigEndian)
+	default:
+		text = string(data)
+	}
+
+	// the text may be a null separated list and we only want the first value
+	if i := strings.IndexByte(text, 0); i != -1 {
+		text = text[:i]
+	}
+
+	return text
+}
+
+func frameText(frames []id3Frame, id string) string {
+	for _, frame := range frames {
+		if frame.id == id {
+			return decodeID3Text(frame.data)
+		}
+	}
+	return ""
+}
+
+type id3Toc struct {
+	topLevel bool
+	children []string
+}
+
+func parseCtoc(data []byte) *id3Toc {
+	_, data = cString(data)
+	if len(data) < 2 {
+		return nil
+	}
+	toc := id3Toc{topLevel: data[0]&0x02 != 0}
+	count := int(data[1])
+	data = data[2:]
+	for i := 0; i < count && len(data) > 0; i++ {
+		var child string
+		child, data = cString(data)
+		toc.children = append(toc.children, child)
+	}
+	return &toc
+}
+
+func probeID3(r io.Reader) (*Info, error) {
+	header := make([]byte, 10)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	major := header[3]
+	flags := header[5]
+	size := syncsafe(header[6:10])
+
+	info := Info{}
+
+	if major != 3 && major != 4 {
+		// ID3v2.2 does not have chapters
+		return &info, nil
+	}
+
+	if size > maxID3Size {
+		// the duration is still read from the audio after the tag
+		return &info, nil
+	}
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags&0x80 != 0 && major == 3 {
+		data = removeUnsync(data)
+	}
+
+	if flags&0x40 != 0 && len(data) >= 4 {
+		// skip the extended header
+		var extSize int
+		if major == 4 {
+			extSize = syncsafe(data[:4])
+		} else {
+			extSize = int(binary.BigEndian.Uint32(data[:4])) + 4
+		}
+		if extSize > len(data) {
+			return &info, nil
+		}
+		data = data[extSize:]
+	}
+
+	chapters := map[string]Chapter{}
+	var toc *id3Toc
+
+	for _, frame := range parseID3Frames(data, major) {
+		switch frame.id {
+		case "CHAP":
+			elementId, body := cString(frame.data)
+			if len(body) < 16 {
+				continue
+			}
+			startMs := binary.BigEndian.Uint32(body[0:4])
+			subframes := parseID3Frames(body[16:], major)
+			chapters[elementId] = Chapter{
+				Start: int64(startMs) * 1000,
+				Title: frameText(subframes, "TIT2"),
+			}
+		case "CTOC":
+			if parsed := parseCtoc(frame.data); parsed != nil && (toc == nil || parsed.topLevel) {
+				toc = parsed
+			}
+		case "TIT2":
+			info.Title = decodeID3Text(frame.data)
+		case "TPE1":
+			info.Artist = decodeID3Text(frame.data)
+		case "TALB":
+			info.Album = decodeID3Text(frame.data)
+		case "TLEN":
+			ms, err := strconv.ParseInt(decodeID3Text(frame.data), 10, 64)
+			if err == nil {
+				info.Duration = ms * 1000
+			}
+		}
+	}
+
+	if toc != nil {
+		// only the top level table of contents lists the chapters, nested
+		// tables are for subchapters
+		for _, child := range toc.children {
+			if chapter, ok := chapters[child]; ok {
+				info.Chapters = append(info.Chapters, chapter)
+			}
+		}
+	} else {
+		for _, chapter := range chapters {
+			info.Chapters = append(info.Chapters, chapter)
+		}
+	}
+
+	sort.SliceStable(info.Chapters, func(i, j int) bool {
+		return info.Chapters[i].Start < info.Chapters[j].Start
+	})
+
+	return &info, nil
+}
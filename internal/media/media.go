@@ -0,0 +1,122 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrUnknownFormat = errors.New("unknown media format")
+
+// Chapter is a named position within a media file. The start is in
+// microseconds like the MPRIS position.
+type Chapter struct {
+	Start int64
+	Title string
+}
+
+// Info is what could be read from the headers of a local media file. Fields
+// that are not known for the format are left at their zero value.
+type Info struct {
+	Duration int64
+	Chapters []Chapter
+	Title    string
+	Artist   string
+	Album    string
+}
+
+// Probe reads the headers of the media file at path. It only reads the parts
+// of the file that hold the metadata, never the whole file.
+func Probe(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 12)
+	_, err = io.ReadFull(f, magic)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrUnknownFormat
+		}
+		return nil, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case string(magic[:3]) == "ID3":
+		info, err := probeID3(f)
+		if err != nil || info.Duration > 0 {
+			return info, err
+		}
+		// the audio follows the tag and its footer
+		offset := int64(10 + syncsafe(magic[6:10]))
+		if magic[5]&0x10 != 0 {
+			offset += 10
+		}
+		info.Duration, err = mp3Duration(f, offset)
+		return info, err
+	case string(magic[4:8]) == "ftyp":
+		return probeMP4(f)
+	case string(magic[:4]) == "fLaC":
+		return probeFLAC(f)
+	case string(magic[:4]) == "OggS":
+		return probeOgg(f)
+	case parseMP3Header(magic) != nil:
+		return probeMP3(f)
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+var mediaExtensions = map[string]bool{
+	".aac":  true,
+	".avi":  true,
+	".flac": true,
+	".m4a":  true,
+	".m4b":  true,
+	".mka":  true,
+	".mkv":  true,
+	".mov":  true,
+	".mp3":  true,
+	".mp4":  true,
+	".oga":  true,
+	".ogg":  true,
+	".opus": true,
+	".wav":  true,
+	".webm": true,
+	".wma":  true,
+}
+
+// IsMediaFile guesses from the extension whether the file is audio or video.
+func IsMediaFile(path string) bool {
+	return mediaExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+var videoExtensions = map[string]bool{
+	".avi":  true,
+	".m4v":  true,
+	".mkv":  true,
+	".mov":  true,
+	".mp4":  true,
+	".webm": true,
+	".wmv":  true,
+}
+
+// IsVideoFile guesses from the extension or its MIME type whether the file is
+// a video.
+func IsVideoFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if videoExtensions[ext] {
+		return true
+	}
+	return strings.HasPrefix(mime.TypeByExtension(ext), "video/")
+}
@@ -0,0 +1,241 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTmpFile(t *testing.T, data []byte) string {
+	f, err := ioutil.TempFile("", "pbm-media")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	return f.Name()
+}
+
+func id3Frame3(id string, body []byte) []byte {
+	frame := []byte(id)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(body)))
+	frame = append(frame, size...)
+	frame = append(frame, 0, 0)
+	return append(frame, body...)
+}
+
+func chapFrame(id string, startMs uint32, title string) []byte {
+	body := append([]byte(id), 0)
+	times := make([]byte, 16)
+	binary.BigEndian.PutUint32(times[0:4], startMs)
+	body = append(body, times...)
+	body = append(body, id3Frame3("TIT2", append([]byte{3}, title...))...)
+	return id3Frame3("CHAP", body)
+}
+
+func makeBox(kind string, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	box := make([]byte, 4)
+	binary.BigEndian.PutUint32(box, uint32(len(data)+8))
+	box = append(box, kind...)
+	return append(box, data...)
+}
+
+func TestProbeID3Chapters(t *testing.T) {
+	ctoc := append([]byte("toc"), 0, 0x03, 2)
+	ctoc = append(ctoc, "ch1\x00ch0\x00"...)
+
+	frames := bytes.Join([][]byte{
+		chapFrame("ch1", 90000, "The Battle"),
+		chapFrame("ch0", 0, "Opening"),
+		chapFrame("extra", 5000, "Not in the table of contents"),
+		id3Frame3("CTOC", ctoc),
+		id3Frame3("TLEN", []byte("\x00120000")),
+		id3Frame3("TPE1", []byte("\x03Leo Tolstoy")),
+	}, nil)
+
+	tag := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 0}
+	size := len(frames)
+	tag[6], tag[7], tag[8], tag[9] = byte(size>>21&0x7f), byte(size>>14&0x7f), byte(size>>7&0x7f), byte(size&0x7f)
+	tag = append(tag, frames...)
+
+	path := writeTmpFile(t, tag)
+	defer os.Remove(path)
+
+	info, err := Probe(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(120000000), info.Duration)
+	require.Equal(t, "Leo Tolstoy", info.Artist)
+	require.Equal(t, []Chapter{
+		{Start: 0, Title: "Opening"},
+		{Start: 90000000, Title: "The Battle"},
+	}, info.Chapters)
+}
+
+func TestProbeID3TooLarge(t *testing.T) {
+	// the syncsafe size claims 256MB
+	tag := []byte{'I', 'D', '3', 4, 0, 0, 0x7f, 0x7f, 0x7f, 0x7f}
+
+	info, err := probeID3(bytes.NewReader(tag))
+	require.NoError(t, err, "Tags that are too large should be skipped without reading them")
+	require.Empty(t, info.Chapters)
+}
+
+func TestProbeMP4Chapters(t *testing.T) {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 3600000)
+
+	chpl := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2}
+	for i, title := range []string{"Intro", "Chapter Two"} {
+		start := make([]byte, 8)
+		binary.BigEndian.PutUint64(start, uint64(i)*600*10000000)
+		chpl = append(chpl, start...)
+		chpl = append(chpl, byte(len(title)))
+		chpl = append(chpl, title...)
+	}
+
+	data := bytes.Join([][]byte{
+		makeBox("ftyp", []byte("M4B \x00\x00\x00\x00")),
+		makeBox("mdat", make([]byte, 100)),
+		makeBox("moov", makeBox("mvhd", mvhd), makeBox("udta",
+			makeBox("chpl", chpl),
+			makeBox("meta", make([]byte, 4), makeBox("ilst",
+				makeBox("\xa9nam", makeBox("data", make([]byte, 8), []byte("War and Peace"))))))),
+	}, nil)
+
+	path := writeTmpFile(t, data)
+	defer os.Remove(path)
+
+	info, err := Probe(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(3600000000), info.Duration)
+	require.Equal(t, "War and Peace", info.Title)
+	require.Equal(t, []Chapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 600000000, Title: "Chapter Two"},
+	}, info.Chapters)
+}
+
+func TestProbeUnknown(t *testing.T) {
+	path := writeTmpFile(t, []byte("this is not a media file"))
+	defer os.Remove(path)
+
+	_, err := Probe(path)
+	require.Equal(t, ErrUnknownFormat, err)
+}
+
+func TestCueSheet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbm-cue")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	audioPath := filepath.Join(dir, "mix.mp3")
+	require.NoError(t, ioutil.WriteFile(audioPath, []byte{}, 0644))
+
+	cue := `PERFORMER "Someone"
+TITLE "A Mix"
+FILE "other.mp3" MP3
+  TRACK 01 AUDIO
+    TITLE "Not This One"
+    INDEX 01 00:00:00
+FILE "mix.mp3" MP3
+  TRACK 02 AUDIO
+    TITLE "First Song"
+    INDEX 01 00:00:00
+  TRACK 03 AUDIO
+    TITLE "Second Song"
+    INDEX 00 03:58:00
+    INDEX 01 04:00:15
+`
+
+	mtime, err := CueSheetsMtime(audioPath)
+	require.NoError(t, err)
+	require.Zero(t, mtime, "There should be no mtime without cue sheets")
+
+	cuePath := filepath.Join(dir, "sheet.cue")
+	require.NoError(t, ioutil.WriteFile(cuePath, []byte(cue), 0644))
+	mtime, err = CueSheetsMtime(audioPath)
+	require.NoError(t, err)
+	require.NotZero(t, mtime)
+
+	found, err := FindCueSheet(audioPath)
+	require.NoError(t, err)
+	require.Equal(t, cuePath, found, "A cue sheet that references the file should be found")
+
+	tracks, err := ReadCueSheet(found, audioPath)
+	require.NoError(t, err)
+	require.Equal(t, []Chapter{
+		{Start: 0, Title: "First Song"},
+		{Start: 240200000, Title: "Second Song"},
+	}, tracks)
+
+	siblingPath := filepath.Join(dir, "mix.cue")
+	require.NoError(t, ioutil.WriteFile(siblingPath, []byte(cue), 0644))
+	found, err = FindCueSheet(audioPath)
+	require.NoError(t, err)
+	require.Equal(t, siblingPath, found, "A sibling cue sheet should be preferred")
+}
+
+func TestProbeMP3Duration(t *testing.T) {
+	// MPEG1 layer III at 128kbps and 44.1kHz
+	header := []byte{0xff, 0xfb, 0x90, 0x00}
+
+	cbr := make([]byte, 16000)
+	copy(cbr, header)
+	path := writeTmpFile(t, cbr)
+	defer os.Remove(path)
+
+	info, err := Probe(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000000), info.Duration)
+
+	vbr := make([]byte, 4000)
+	copy(vbr, header)
+	copy(vbr[36:], "Xing")
+	binary.BigEndian.PutUint32(vbr[40:], 0x01)
+	binary.BigEndian.PutUint32(vbr[44:], 100)
+	tag := []byte("ID3\x04\x00\x00\x00\x00\x00\x00")
+	path = writeTmpFile(t, append(tag, vbr...))
+	defer os.Remove(path)
+
+	info, err = Probe(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(100*1152*1000000/44100), info.Duration)
+}
+
+func TestProbeFLACDuration(t *testing.T) {
+	streamInfo := make([]byte, 34)
+	// 44.1kHz, stereo, 16 bits and 88200 samples
+	packed := uint64(44100)<<44 | uint64(1)<<41 | uint64(15)<<36 | 88200
+	binary.BigEndian.PutUint64(streamInfo[10:18], packed)
+
+	data := append([]byte("fLaC"), 0x80, 0, 0, 34)
+	path := writeTmpFile(t, append(data, streamInfo...))
+	defer os.Remove(path)
+
+	info, err := Probe(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(2000000), info.Duration)
+}
+
+func TestDetectMimeType(t *testing.T) {
+	// a file that says it is a video but is really an audiobook
+	path := writeTmpFile(t, makeBox("ftyp", []byte("M4B "), make([]byte, 8)))
+	defer os.Remove(path)
+	renamed := path + ".mp4"
+	require.NoError(t, os.Rename(path, renamed))
+	defer os.Remove(renamed)
+	require.Equal(t, "audio/mp4", DetectMimeType(renamed))
+
+	flac := writeTmpFile(t, append([]byte("fLaC"), make([]byte, 40)...))
+	defer os.Remove(flac)
+	require.Equal(t, "audio/flac", DetectMimeType(flac))
+
+	require.Equal(t, "audio/mpeg", DetectMimeType("/does/not/exist.mp3"), "Missing files should fall back to the extension")
+	require.Equal(t, "", DetectMimeType("/does/not/exist"))
+}
@@ -0,0 +1,117 @@
+package media
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLength is how much of the file is read to detect its type. It is the
+// most that http.DetectContentType looks at.
+const sniffLength = 512
+
+// sniffMedia detects the common audio and video formats that the sniffing in
+// net/http does not know or gets wrong.
+func sniffMedia(head []byte) string {
+	if len(head) < 12 {
+		return ""
+	}
+
+	switch {
+	case string(head[:3]) == "ID3" || parseMP3Header(head) != nil:
+		return "audio/mpeg"
+	case string(head[4:8]) == "ftyp":
+		switch string(head[8:12]) {
+		case "M4A ", "M4B ", "M4P ":
+			return "audio/mp4"
+		case "qt  ":
+			return "video/quicktime"
+		}
+		return "video/mp4"
+	case string(head[:4]) == "fLaC":
+		return "audio/flac"
+	case string(head[:4]) == "OggS":
+		if bytes.Contains(head, []byte("theora")) {
+			return "video/ogg"
+		}
+		return "audio/ogg"
+	case bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		if bytes.Contains(head, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	}
+
+	return ""
+}
+
+// the types of media files for systems without a mime.types file
+var mediaTypes = map[string]string{
+	".aac":  "audio/aac",
+	".avi":  "video/x-msvideo",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".m4b":  "audio/mp4",
+	".m4v":  "video/mp4",
+	".mka":  "audio/x-matroska",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".webm": "video/webm",
+	".wma":  "audio/x-ms-wma",
+	".wmv":  "video/x-ms-wmv",
+}
+
+// typeByExtension is the MIME type for the extension of the path without its
+// parameters.
+func typeByExtension(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if mimeType, ok := mediaTypes[ext]; ok {
+		return mimeType
+	}
+	mimeType := mime.TypeByExtension(ext)
+	return strings.TrimSpace(strings.Split(mimeType, ";")[0])
+}
+
+// DetectMimeType guesses the MIME type of the file from its first bytes and
+// then from its extension. It is empty when the type is not known.
+func DetectMimeType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return typeByExtension(path)
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return typeByExtension(path)
+	}
+	head = head[:n]
+
+	if mimeType := sniffMedia(head); len(mimeType) > 0 {
+		return mimeType
+	}
+
+	mimeType := strings.Split(http.DetectContentType(head), ";")[0]
+	if mimeType == "application/octet-stream" || strings.HasPrefix(mimeType, "text/plain") {
+		// the content does not say, so trust the extension
+		if byExt := typeByExtension(path); len(byExt) > 0 {
+			return byExt
+		}
+		if mimeType == "application/octet-stream" {
+			return ""
+		}
+	}
+
+	return mimeType
+}
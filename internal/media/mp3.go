@@ -0,0 +1,152 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// bitrates in kbps by version (MPEG1 or MPEG2/2.5) and layer
+var mp3Bitrates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mp3SampleRates = [3]int{44100, 48000, 32000}
+
+type mp3Frame struct {
+	mpeg1           bool
+	layer           int
+	bitrate         int
+	sampleRate      int
+	mono            bool
+	samplesPerFrame int
+}
+
+func parseMP3Header(header []byte) *mp3Frame {
+	if len(header) < 4 || header[0] != 0xff || header[1]&0xe0 != 0xe0 {
+		return nil
+	}
+
+	versionBits := (header[1] >> 3) & 0x03
+	layerBits := (header[1] >> 1) & 0x03
+	bitrateIndex := header[2] >> 4
+	sampleRateIndex := (header[2] >> 2) & 0x03
+
+	if versionBits == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return nil
+	}
+
+	frame := mp3Frame{
+		mpeg1: versionBits == 3,
+		layer: 4 - int(layerBits),
+		mono:  header[3]>>6 == 3,
+	}
+
+	version := 1
+	if frame.mpeg1 {
+		version = 0
+	}
+	frame.bitrate = mp3Bitrates[version][frame.layer-1][bitrateIndex] * 1000
+
+	frame.sampleRate = mp3SampleRates[sampleRateIndex]
+	switch versionBits {
+	case 2:
+		frame.sampleRate /= 2
+	case 0:
+		frame.sampleRate /= 4
+	}
+
+	switch {
+	case frame.layer == 1:
+		frame.samplesPerFrame = 384
+	case frame.layer == 3 && !frame.mpeg1:
+		frame.samplesPerFrame = 576
+	default:
+		frame.samplesPerFrame = 1152
+	}
+
+	return &frame
+}
+
+// mp3Duration finds the duration of the mp3 stream that starts at offset. The
+// number of frames is read from a Xing or VBRI header if there is one and is
+// otherwise estimated from the bitrate of the first frame.
+func mp3Duration(r io.ReadSeeker, offset int64) (int64, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	// look for the first frame in a small window after the tag
+	buf := make([]byte, 16*1024)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		frame := parseMP3Header(buf[i:])
+		if frame == nil {
+			continue
+		}
+		data := buf[i:]
+
+		// the Xing header follows the side information
+		sideInfo := 32
+		if frame.mpeg1 && frame.mono || !frame.mpeg1 && !frame.mono {
+			sideInfo = 17
+		} else if !frame.mpeg1 && frame.mono {
+			sideInfo = 9
+		}
+		xing := 4 + sideInfo
+		if len(data) >= xing+12 {
+			tag := string(data[xing : xing+4])
+			flags := binary.BigEndian.Uint32(data[xing+4 : xing+8])
+			if (tag == "Xing" || tag == "Info") && flags&0x01 != 0 {
+				frames := int64(binary.BigEndian.Uint32(data[xing+8 : xing+12]))
+				return frames * int64(frame.samplesPerFrame) * 1000000 / int64(frame.sampleRate), nil
+			}
+		}
+
+		if len(data) >= 36+18 && string(data[36:40]) == "VBRI" {
+			frames := int64(binary.BigEndian.Uint32(data[36+14 : 36+18]))
+			return frames * int64(frame.samplesPerFrame) * 1000000 / int64(frame.sampleRate), nil
+		}
+
+		audioSize := size - offset - int64(i)
+
+		// leave out the ID3v1 tag at the end
+		tag := make([]byte, 3)
+		if _, err := r.Seek(size-128, io.SeekStart); err == nil {
+			if _, err := io.ReadFull(r, tag); err == nil && string(tag) == "TAG" {
+				audioSize -= 128
+			}
+		}
+
+		return audioSize * 8 * 1000000 / int64(frame.bitrate), nil
+	}
+
+	return 0, nil
+}
+
+func probeMP3(r io.ReadSeeker) (*Info, error) {
+	duration, err := mp3Duration(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Info{Duration: duration}, nil
+}
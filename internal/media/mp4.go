@@ -0,0 +1,395 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errInvalidBox = errors.New("invalid mp4 box")
+
+type mp4Box struct {
+	kind string
+	data []byte
+}
+
+// readBoxHeader returns the type of the box at the current offset and the
+// size of its body.
+func readBoxHeader(r io.Reader) (string, int64, error) {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return "", 0, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	kind := string(header[4:8])
+	headerSize := int64(8)
+
+	if size == 1 {
+		large := make([]byte, 8)
+		_, err = io.ReadFull(r, large)
+		if err != nil {
+			return "", 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(large))
+		headerSize = 16
+	} else if size == 0 {
+		// the box extends to the end of the file
+		return kind, -1, nil
+	}
+
+	if size < headerSize {
+		return "", 0, errInvalidBox
+	}
+
+	return kind, size - headerSize, nil
+}
+
+// childBoxes splits the body of a container box into its children.
+func childBoxes(data []byte) []mp4Box {
+	boxes := []mp4Box{}
+
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		kind := string(data[4:8])
+		headerSize := uint64(8)
+		if size == 1 {
+			if len(data) < 16 {
+				break
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			break
+		}
+		boxes = append(boxes, mp4Box{kind: kind, data: data[headerSize:size]})
+		data = data[size:]
+	}
+
+	return boxes
+}
+
+func findBox(boxes []mp4Box, path ...string) *mp4Box {
+	for _, box := range boxes {
+		if box.kind == path[0] {
+			if len(path) == 1 {
+				return &box
+			}
+			return findBox(childBoxes(box.data), path[1:]...)
+		}
+	}
+	return nil
+}
+
+// parseTimes reads the timescale and duration of an mvhd or mdhd box.
+func parseTimes(data []byte) (uint32, uint64, bool) {
+	if len(data) < 4 {
+		return 0, 0, false
+	}
+
+	if data[0] == 1 {
+		if len(data) < 32 {
+			return 0, 0, false
+		}
+		return binary.BigEndian.Uint32(data[20:24]), binary.BigEndian.Uint64(data[24:32]), true
+	}
+
+	if len(data) < 20 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint32(data[12:16]), uint64(binary.BigEndian.Uint32(data[16:20])), true
+}
+
+func toMicroseconds(value uint64, timescale uint32) int64 {
+	if timescale == 0 {
+		return 0
+	}
+	return int64(value/uint64(timescale)*1000000 + value%uint64(timescale)*1000000/uint64(timescale))
+}
+
+// parseChpl reads the Nero chapter list from the user data of the movie.
+func parseChpl(data []byte) []Chapter {
+	chapters := []Chapter{}
+
+	if len(data) < 5 {
+		return chapters
+	}
+	version := data[0]
+	data = data[4:]
+	if version != 0 {
+		if len(data) < 4 {
+			return chapters
+		}
+		data = data[4:]
+	}
+	count := int(data[0])
+	data = data[1:]
+
+	for i := 0; i < count && len(data) >= 9; i++ {
+		// the start time is in units of 100 nanoseconds
+		start := int64(binary.BigEndian.Uint64(data[:8])) / 10
+		titleLen := int(data[8])
+		data = data[9:]
+		if titleLen > len(data) {
+			break
+		}
+		chapters = append(chapters, Chapter{Start: start, Title: string(data[:titleLen])})
+		data = data[titleLen:]
+	}
+
+	return chapters
+}
+
+type mp4Track struct {
+	id          uint32
+	chapterRefs []uint32
+	timescale   uint32
+	stbl        []mp4Box
+}
+
+func parseTrack(data []byte) *mp4Track {
+	boxes := childBoxes(data)
+	track := mp4Track{}
+
+	tkhd := findBox(boxes, "tkhd")
+	if tkhd == nil || len(tkhd.data) < 24 {
+		return nil
+	}
+	if tkhd.data[0] == 1 {
+		track.id = binary.BigEndian.Uint32(tkhd.data[20:24])
+	} else {
+		track.id = binary.BigEndian.Uint32(tkhd.data[12:16])
+	}
+
+	if chap := findBox(boxes, "tref", "chap"); chap != nil {
+		for i := 0; i+4 <= len(chap.data); i += 4 {
+			track.chapterRefs = append(track.chapterRefs, binary.BigEndian.Uint32(chap.data[i:i+4]))
+		}
+	}
+
+	if mdhd := findBox(boxes, "mdia", "mdhd"); mdhd != nil {
+		track.timescale, _, _ = parseTimes(mdhd.data)
+	}
+
+	if stbl := findBox(boxes, "mdia", "minf", "stbl"); stbl != nil {
+		track.stbl = childBoxes(stbl.data)
+	}
+
+	return &track
+}
+
+// table reads the entries of a full box that has a 32 bit entry count
+// followed by fixed size entries.
+func table(box *mp4Box, skip int, entrySize int) [][]byte {
+	entries := [][]byte{}
+	if box == nil || len(box.data) < 8+skip {
+		return entries
+	}
+	count := int(binary.BigEndian.Uint32(box.data[4+skip : 8+skip]))
+	data := box.data[8+skip:]
+	for i := 0; i < count && len(data) >= entrySize; i++ {
+		entries = append(entries, data[:entrySize])
+		data = data[entrySize:]
+	}
+	return entries
+}
+
+// readTextSamples reads the chapter titles and times from a QuickTime chapter
+// track. Each sample is a 16 bit length followed by the text.
+func readTextSamples(r io.ReadSeeker, track *mp4Track) ([]Chapter, error) {
+	chapters := []Chapter{}
+
+	// sample durations
+	durations := []uint32{}
+	for _, entry := range table(findBox(track.stbl, "stts"), 0, 8) {
+		count := binary.BigEndian.Uint32(entry[:4])
+		delta := binary.BigEndian.Uint32(entry[4:8])
+		for i := uint32(0); i < count && len(durations) < 0xffff; i++ {
+			durations = append(durations, delta)
+		}
+	}
+
+	// sample sizes
+	sizes := []uint32{}
+	if stsz := findBox(track.stbl, "stsz"); stsz != nil && len(stsz.data) >= 12 {
+		sampleSize := binary.BigEndian.Uint32(stsz.data[4:8])
+		count := int(binary.BigEndian.Uint32(stsz.data[8:12]))
+		if sampleSize != 0 {
+			for i := 0; i < count && i < len(durations); i++ {
+				sizes = append(sizes, sampleSize)
+			}
+		} else {
+			for _, entry := range table(stsz, 4, 4) {
+				sizes = append(sizes, binary.BigEndian.Uint32(entry))
+			}
+		}
+	}
+
+	// chunk offsets
+	offsets := []uint64{}
+	for _, entry := range table(findBox(track.stbl, "stco"), 0, 4) {
+		offsets = append(offsets, uint64(binary.BigEndian.Uint32(entry)))
+	}
+	for _, entry := range table(findBox(track.stbl, "co64"), 0, 8) {
+		offsets = append(offsets, binary.BigEndian.Uint64(entry))
+	}
+
+	// which chunks the samples are in
+	stsc := table(findBox(track.stbl, "stsc"), 0, 12)
+
+	sample := 0
+	elapsed := uint64(0)
+	for chunk := range offsets {
+		samplesPerChunk := uint32(0)
+		for _, entry := range stsc {
+			if binary.BigEndian.Uint32(entry[:4]) <= uint32(chunk+1) {
+				samplesPerChunk = binary.BigEndian.Uint32(entry[4:8])
+			}
+		}
+
+		offset := offsets[chunk]
+		for i := uint32(0); i < samplesPerChunk && sample < len(sizes) && sample < len(durations); i++ {
+			title, err := readTextSample(r, int64(offset), sizes[sample])
+			if err != nil {
+				return nil, err
+			}
+			chapters = append(chapters, Chapter{
+				Start: toMicroseconds(elapsed, track.timescale),
+				Title: title,
+			})
+			offset += uint64(sizes[sample])
+			elapsed += uint64(durations[sample])
+			sample++
+		}
+	}
+
+	return chapters, nil
+}
+
+func readTextSample(r io.ReadSeeker, offset int64, size uint32) (string, error) {
+	if size < 2 || size > 0xffff+2 {
+		return "", nil
+	}
+
+	_, err := r.Seek(offset, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return "", err
+	}
+
+	length := int(binary.BigEndian.Uint16(data[:2]))
+	data = data[2:]
+	if length > len(data) {
+		length = len(data)
+	}
+	data = data[:length]
+
+	if len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff {
+		return decodeUTF16(data[2:], binary.BigEndian), nil
+	}
+
+	return string(data), nil
+}
+
+// ilstText reads a text item from an iTunes metadata list
+func ilstText(ilst *mp4Box, kind string) string {
+	item := findBox(childBoxes(ilst.data), kind, "data")
+	if item == nil || len(item.data) < 8 {
+		return ""
+	}
+	// the value follows the type and locale
+	return string(item.data[8:])
+}
+
+func probeMP4(r io.ReadSeeker) (*Info, error) {
+	var moov []byte
+
+	// find the movie box at the top level, skipping over the media data
+	for moov == nil {
+		kind, size, err := readBoxHeader(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrUnknownFormat
+			}
+			return nil, err
+		}
+
+		if kind == "moov" {
+			if size < 0 || size > 64<<20 {
+				return nil, errInvalidBox
+			}
+			moov = make([]byte, size)
+			_, err = io.ReadFull(r, moov)
+			if err != nil {
+				return nil, err
+			}
+		} else if size < 0 {
+			return nil, ErrUnknownFormat
+		} else {
+			_, err = r.Seek(size, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	info := Info{}
+	boxes := childBoxes(moov)
+
+	if mvhd := findBox(boxes, "mvhd"); mvhd != nil {
+		if timescale, duration, ok := parseTimes(mvhd.data); ok {
+			info.Duration = toMicroseconds(duration, timescale)
+		}
+	}
+
+	// iTunes style metadata
+	if meta := findBox(boxes, "udta", "meta"); meta != nil && len(meta.data) > 4 {
+		// meta is a full box with a version and flags before the children
+		if ilst := findBox(childBoxes(meta.data[4:]), "ilst"); ilst != nil {
+			info.Title = ilstText(ilst, "\xa9nam")
+			info.Artist = ilstText(ilst, "\xa9ART")
+			info.Album = ilstText(ilst, "\xa9alb")
+		}
+	}
+
+	// QuickTime chapters are a text track referenced by the audio track
+	tracks := map[uint32]*mp4Track{}
+	chapterIds := []uint32{}
+	for _, box := range boxes {
+		if box.kind != "trak" {
+			continue
+		}
+		if track := parseTrack(box.data); track != nil {
+			tracks[track.id] = track
+			chapterIds = append(chapterIds, track.chapterRefs...)
+		}
+	}
+
+	for _, id := range chapterIds {
+		if track, ok := tracks[id]; ok {
+			chapters, err := readTextSamples(r, track)
+			if err != nil {
+				return nil, err
+			}
+			if len(chapters) > 0 {
+				info.Chapters = chapters
+				return &info, nil
+			}
+		}
+	}
+
+	// otherwise fall back to Nero chapters
+	if chpl := findBox(boxes, "udta", "chpl"); chpl != nil {
+		info.Chapters = parseChpl(chpl.data)
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,85 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+func probeFLAC(r io.Reader) (*Info, error) {
+	// the STREAMINFO block is always the first metadata block
+	header := make([]byte, 4+4+34)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	info := Info{}
+	if header[4]&0x7f != 0 {
+		return &info, nil
+	}
+
+	streamInfo := header[8:]
+	packed := binary.BigEndian.Uint64(streamInfo[10:18])
+	sampleRate := int64(packed >> 44)
+	samples := int64(packed & 0xfffffffff)
+	if sampleRate > 0 {
+		info.Duration = samples * 1000000 / sampleRate
+	}
+
+	return &info, nil
+}
+
+// probeOgg reads the duration of a Vorbis or Opus stream from the granule
+// position of the last page.
+func probeOgg(r io.ReadSeeker) (*Info, error) {
+	first := make([]byte, 27+255+19)
+	n, err := io.ReadFull(r, first)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	first = first[:n]
+
+	info := Info{}
+
+	var sampleRate, preSkip int64
+	if i := bytes.Index(first, []byte("\x01vorbis")); i != -1 && len(first) >= i+16 {
+		sampleRate = int64(binary.LittleEndian.Uint32(first[i+12 : i+16]))
+	} else if i := bytes.Index(first, []byte("OpusHead")); i != -1 && len(first) >= i+12 {
+		// opus granule positions are always at 48kHz
+		sampleRate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(first[i+10 : i+12]))
+	}
+	if sampleRate == 0 {
+		return &info, nil
+	}
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	start := size - 64*1024
+	if start < 0 {
+		start = 0
+	}
+	_, err = r.Seek(start, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	tail, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	i := bytes.LastIndex(tail, []byte("OggS"))
+	if i == -1 || len(tail) < i+14 {
+		return &info, nil
+	}
+	granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14]))
+	if granule > preSkip {
+		info.Duration = (granule - preSkip) * 1000000 / sampleRate
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,243 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/altdesktop/playerbm/internal/media"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"unicode"
+)
+
+// A Book is a directory of media files that are played in order, like an
+// audiobook that comes as a file for each chapter.
+type Book struct {
+	Dir   string
+	Files []BookFile
+	// the index of the file that is being listened to or -1 when all the
+	// files are finished
+	Current int
+}
+
+type BookFile struct {
+	Url *XesamUrl
+	// nil when the file does not have a bookmark
+	Bookmark *Bookmark
+	// zero when the length is not known
+	Length int64
+}
+
+// NaturalLess compares strings so that runs of digits are ordered by their
+// number, which puts "2 - Two.mp3" before "10 - Ten.mp3".
+func NaturalLess(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if unicode.IsDigit(ra[i]) && unicode.IsDigit(rb[j]) {
+			si, sj := i, j
+			for i < len(ra) && unicode.IsDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && unicode.IsDigit(rb[j]) {
+				j++
+			}
+			na := trimZeros(ra[si:i])
+			nb := trimZeros(rb[sj:j])
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if string(na) != string(nb) {
+				return string(na) < string(nb)
+			}
+			continue
+		}
+
+		ca, cb := unicode.ToLower(ra[i]), unicode.ToLower(rb[j])
+		if ca != cb {
+			return ca < cb
+		}
+		i++
+		j++
+	}
+
+	if len(ra)-i != len(rb)-j {
+		return len(ra)-i < len(rb)-j
+	}
+	return a < b
+}
+
+func trimZeros(digits []rune) []rune {
+	for len(digits) > 1 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	return digits
+}
+
+// ListMediaFiles lists the media files in the directory in natural order.
+func ListMediaFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, info := range infos {
+		if info.Mode().IsRegular() && media.IsMediaFile(info.Name()) {
+			paths = append(paths, filepath.Join(dir, info.Name()))
+		}
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return NaturalLess(filepath.Base(paths[i]), filepath.Base(paths[j]))
+	})
+
+	return paths, nil
+}
+
+// findFileBookmark finds the bookmark for the file by its inode and mtime or
+// by its url. Unlike GetBookmark, this never reads the file to hash it so it
+// is cheap to call for every file in a directory. It returns nil when there is
+// no bookmark.
+func findFileBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
+	var stat syscall.Stat_t
+	err := syscall.Stat(url.UnescapedPath(), &stat)
+	if err != nil {
+		return nil, &FileError{err: "File does not exist"}
+	}
+
+	bm, err := scanBookmark(db.QueryRow(`
+    select `+bookmarkColumns+`
+    from bookmarks
+    where (inode = ? and mtime = ?) or url = ?
+    order by updated desc
+    limit 1;
+    `, fmt.Sprintf("%d", stat.Ino), stat.Mtim.Nano(), url.String()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bm.Url = url
+	return bm, nil
+}
+
+// GetBook reads the progress through the media files in the directory from
+// their bookmarks. The current file is the file after the last one in natural
+// order that was finished, or the last one that was started if it was not.
+// Lengths that are not in the bookmarks are read from the files.
+func GetBook(db *sql.DB, dir string) (*Book, error) {
+	paths, err := ListMediaFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	book := Book{Dir: dir, Current: 0}
+	for i, path := range paths {
+		file := BookFile{Url: FileUrl(path)}
+
+		file.Bookmark, err = findFileBookmark(db, file.Url)
+		if err != nil {
+			return nil, err
+		}
+
+		if file.Bookmark != nil {
+			book.Current = i
+			if file.Bookmark.Finished == 1 {
+				book.Current = i + 1
+			}
+			file.Length = file.Bookmark.Length
+		}
+
+		if file.Length == 0 {
+			info, err := media.Probe(path)
+			if err != nil {
+				log.Printf("[DEBUG] could not read the length of %s: %+v", path, err)
+			} else {
+				file.Length = info.Duration
+			}
+		}
+
+		book.Files = append(book.Files, file)
+	}
+
+	if book.Current >= len(book.Files) {
+		book.Current = -1
+	}
+
+	return &book, nil
+}
+
+// CurrentFile is the file that is being listened to or nil if the book is
+// finished.
+func (book *Book) CurrentFile() *BookFile {
+	if book.Current == -1 || book.Current >= len(book.Files) {
+		return nil
+	}
+	return &book.Files[book.Current]
+}
+
+func (book *Book) Length() int64 {
+	var length int64
+	for _, file := range book.Files {
+		length += file.Length
+	}
+	return length
+}
+
+// Position is the total time listened to. Files before the current one count
+// as listened to in full.
+func (book *Book) Position() int64 {
+	var position int64
+	for i, file := range book.Files {
+		switch {
+		case book.Current == -1 || i < book.Current:
+			position += file.Length
+		case file.Bookmark == nil:
+		case file.Bookmark.Finished == 1:
+			position += file.Length
+		default:
+			position += file.Bookmark.Position
+		}
+	}
+	return position
+}
+
+// Progress is the fraction of the book that was listened to from 0 to 1.
+func (book *Book) Progress() float64 {
+	length := book.Length()
+	if length == 0 {
+		return 0
+	}
+	progress := float64(book.Position()) / float64(length)
+	if progress > 1 {
+		return 1
+	}
+	return progress
+}
+
+// NextFile is the media file after the file at the url in natural order in
+// its directory or nil if it is the last one.
+func NextFile(url *XesamUrl) (*XesamUrl, error) {
+	if url.Scheme() != "file" {
+		return nil, nil
+	}
+
+	path := url.UnescapedPath()
+	paths, err := ListMediaFiles(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sibling := range paths {
+		if NaturalLess(filepath.Base(path), filepath.Base(sibling)) {
+			return FileUrl(sibling), nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	expected := []string{"01 - One.mp3", "2 - Two.mp3", "10 - Ten.mp3", "part 1a.mp3", "Part 1b.mp3"}
+	for i := range expected {
+		for j := range expected {
+			require.Equal(t, i < j, NaturalLess(expected[i], expected[j]),
+				"%s should sort before %s", expected[i], expected[j])
+		}
+	}
+}
+
+func TestBook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbm-book")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	names := []string{"10.mp3", "9.mp3", "1.mp3", "cover.jpg"}
+	for _, name := range names {
+		data := []byte(uuid.New().String())
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	book, err := GetBook(db, dir)
+	require.NoError(t, err)
+	require.Len(t, book.Files, 3, "Only media files should be in the book")
+	require.Equal(t, "1.mp3", filepath.Base(book.Files[0].Url.UnescapedPath()))
+	require.Equal(t, "10.mp3", filepath.Base(book.Files[2].Url.UnescapedPath()))
+	require.Equal(t, 0, book.Current, "The first file should be current in a new book")
+
+	next, err := NextFile(FileUrl(filepath.Join(dir, "9.mp3")))
+	require.NoError(t, err)
+	require.Equal(t, FileUrl(filepath.Join(dir, "10.mp3")).String(), next.String())
+	next, err = NextFile(FileUrl(filepath.Join(dir, "10.mp3")))
+	require.NoError(t, err)
+	require.Nil(t, next, "The last file should not have a next file")
+
+	save := func(name string, position int64) {
+		bm, err := GetBookmark(db, FileUrl(filepath.Join(dir, name)), nil)
+		require.NoError(t, err)
+		bm.Length = int64(100e+6)
+		bm.Position = position
+		require.NoError(t, bm.Save(db))
+	}
+
+	save("1.mp3", int64(100e+6))
+	save("9.mp3", int64(50e+6))
+
+	book, err = GetBook(db, dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, book.Current)
+	require.Equal(t, int64(150e+6), book.Position())
+	require.Equal(t, int64(200e+6), book.Length(),
+		"Files without a known length should not count towards the length")
+
+	save("9.mp3", int64(100e+6))
+	book, err = GetBook(db, dir)
+	require.NoError(t, err)
+	require.Equal(t, 2, book.Current, "The file after a finished file should be current")
+
+	save("10.mp3", int64(100e+6))
+	book, err = GetBook(db, dir)
+	require.NoError(t, err)
+	require.Nil(t, book.CurrentFile(), "The book should be finished")
+	require.Equal(t, 1.0, book.Progress())
+}
@@ -14,17 +14,34 @@ import (
 var finishedThreshold = int64(1e+7)
 
 type Bookmark struct {
-	Id          int64
-	Url         *XesamUrl
-	Hash        string
-	Position    int64
-	Length      int64
-	Mtime       int64
-	Finished    int
-	Inode       string
-	Created     int64
-	Updated     int64
-	needsCreate bool
+	Id             int64
+	Url            *XesamUrl
+	Hash           string
+	Position       int64
+	Length         int64
+	Mtime          int64
+	Finished       int
+	Inode          string
+	Created        int64
+	Updated        int64
+	Title          string
+	Artist         string
+	Album          string
+	Notes          string
+	PlayerCmd      string
+	Chapters       []Chapter
+	Tags           []string
+	Segments       []Segment
+	Listened       []Segment
+	Settings       []Setting
+	needsCreate    bool
+	chaptersMtime  int64
+	chaptersSource string
+	cueMtime       int64
+	chaptersDirty  bool
+	listenedDirty  bool
+	settingsDirty  bool
+	policy         *Policy
 }
 
 type FileError struct {
@@ -48,6 +65,35 @@ func sha256sum(file *os.File) (string, error) {
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
+// bookmarkColumns are the columns scanned by scanBookmark in order
+const bookmarkColumns = `id, url, position, hash, inode, mtime, length,
+        finished, updated, created, title, artist, album, notes, chapters_mtime,
+        chapters_source, cue_mtime, player_cmd`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBookmark(row rowScanner) (*Bookmark, error) {
+	bm := Bookmark{}
+	var url string
+	err := row.Scan(&bm.Id, &url, &bm.Position, &bm.Hash, &bm.Inode, &bm.Mtime,
+		&bm.Length, &bm.Finished, &bm.Updated, &bm.Created, &bm.Title, &bm.Artist,
+		&bm.Album, &bm.Notes, &bm.chaptersMtime, &bm.chaptersSource, &bm.cueMtime,
+		&bm.PlayerCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedUrl, err := ParseXesamUrl(url)
+	if err != nil {
+		return nil, err
+	}
+	bm.Url = parsedUrl
+
+	return &bm, nil
+}
+
 func getFileSchemeBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
 	log.Printf("[DEBUG] getting bookmark from file scheme path")
 	// Identified by the hash with filesystem heuristics to avoid reading the
@@ -71,7 +117,7 @@ func getFileSchemeBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
 	// First try: inode and mtime should approximately identify a file on the
 	// file system without reading the file
 	stmt, err := db.Prepare(`
-    select id, position, hash, length, finished, updated, created
+    select ` + bookmarkColumns + `
     from bookmarks
     where inode = ? and mtime = ?
     limit 1;
@@ -79,12 +125,9 @@ func getFileSchemeBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
 	if err != nil {
 		return nil, err
 	}
-	row := stmt.QueryRow(bm.Inode, bm.Mtime)
-	err = row.Scan(&bm.Id, &bm.Position, &bm.Hash, &bm.Length, &bm.Finished,
-		&bm.Updated, &bm.Created)
+	found, err := scanBookmark(stmt.QueryRow(bm.Inode, bm.Mtime))
 	if err == nil {
 		log.Printf("[DEBUG] got bookmark from inode/mtime")
-		return &bm, nil
 	} else if err == sql.ErrNoRows {
 		// Second try: read the file and try to find it by the hash
 		f, err := os.Open(url.UnescapedPath())
@@ -100,7 +143,7 @@ func getFileSchemeBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
 		bm.Hash = hash
 
 		stmt, err = db.Prepare(`
-        select id, position, length, finished, updated, created
+        select ` + bookmarkColumns + `
         from bookmarks where hash = ?
         limit 1;
         `)
@@ -108,27 +151,31 @@ func getFileSchemeBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
 			return nil, err
 		}
 
-		row = stmt.QueryRow(hash)
-		err = row.Scan(&bm.Id, &bm.Position, &bm.Length, &bm.Finished,
-			&bm.Updated, &bm.Created)
+		found, err = scanBookmark(stmt.QueryRow(hash))
 		if err == sql.ErrNoRows {
 			log.Printf("[DEBUG] this is a new bookmark")
 			bm.needsCreate = true
+			return &bm, nil
 		} else if err != nil {
 			return nil, err
 		} else {
 			log.Printf("[DEBUG] got bookmark from hash")
 		}
+	} else {
+		return nil, err
 	}
 
-	return &bm, nil
+	// the file may have been moved or modified since the bookmark was saved
+	found.Url = bm.Url
+	found.Inode = bm.Inode
+	found.Mtime = bm.Mtime
+
+	return found, nil
 }
 
 func getOtherSchemeBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
-	bookmark := Bookmark{Url: url}
-
 	stmt, err := db.Prepare(`
-    select id, position, length, finished, updated, created
+    select ` + bookmarkColumns + `
     from bookmarks
     where url = ?
     limit 1;
@@ -136,78 +183,137 @@ func getOtherSchemeBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = stmt.QueryRow(url.String()).Scan(&bookmark.Id, &bookmark.Position,
-		&bookmark.Length, &bookmark.Finished, &bookmark.Updated, &bookmark.Created)
+	bookmark, err := scanBookmark(stmt.QueryRow(url.String()))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			bookmark.needsCreate = true
-			return &bookmark, nil
+			return &Bookmark{Url: url, needsCreate: true}, nil
 		}
 		return nil, err
 	}
 
-	return &bookmark, nil
+	return bookmark, nil
+}
+
+// tagFilter matches bookmarks with a tag or all bookmarks if the tag is empty.
+// The tag is given twice as the parameters.
+const tagFilter = `(? = '' or id in (
+        select bookmark_id from bookmark_tags
+        where tag_id in (select id from tags where name = ?)))`
+
+// loadDetails loads the parts of the bookmark that are not stored in the
+// bookmarks table.
+func loadDetails(bm *Bookmark, db *sql.DB) error {
+	err := loadChapters(bm, db)
+	if err != nil {
+		return err
+	}
+	err = loadSegments(bm, db)
+	if err != nil {
+		return err
+	}
+	err = loadListened(bm, db)
+	if err != nil {
+		return err
+	}
+	err = loadSettings(bm, db)
+	if err != nil {
+		return err
+	}
+	return loadTags(bm, db)
 }
 
 func ListBookmarks(db *sql.DB) ([]Bookmark, error) {
+	return ListTaggedBookmarks(db, "")
+}
+
+// ListTaggedBookmarks lists the bookmarks with the tag or all bookmarks if
+// the tag is empty.
+func ListTaggedBookmarks(db *sql.DB, tag string) ([]Bookmark, error) {
 	var bookmarks []Bookmark
 	rows, err := db.Query(`
-    select id, url, position, hash, inode, mtime, length, finished, updated,
-        created
+    select `+bookmarkColumns+`
     from bookmarks
+    where `+tagFilter+`
     order by updated desc
-    `)
+    `, tag, tag)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		bm := Bookmark{}
-		var url string
-		err = rows.Scan(&bm.Id, &url, &bm.Position, &bm.Hash, &bm.Inode,
-			&bm.Mtime, &bm.Length, &bm.Finished, &bm.Updated, &bm.Created)
+		bm, err := scanBookmark(rows)
 		if err != nil {
 			return nil, err
 		}
-		parsedUrl, err := ParseXesamUrl(url)
+		bookmarks = append(bookmarks, *bm)
+	}
+	rows.Close()
+
+	for i := range bookmarks {
+		err = loadDetails(&bookmarks[i], db)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		bm.Url = parsedUrl
-		bookmarks = append(bookmarks, bm)
 	}
 
 	return bookmarks, nil
 }
 
-func GetBookmark(db *sql.DB, url *XesamUrl) (*Bookmark, error) {
+// GetBookmark returns the bookmark for the url or a new bookmark if it does
+// not exist yet. The policy applies to the bookmark when it is saved.
+func GetBookmark(db *sql.DB, url *XesamUrl, policy *Policy) (*Bookmark, error) {
+	var bm *Bookmark
+	var err error
+
 	if url.Scheme() == "file" {
-		return getFileSchemeBookmark(db, url)
+		bm, err = getFileSchemeBookmark(db, url)
 	} else {
-		return getOtherSchemeBookmark(db, url)
+		bm, err = getOtherSchemeBookmark(db, url)
+	}
+	if err != nil {
+		return nil, err
 	}
+
+	bm.policy = policy
+	if bm.Exists() {
+		err = loadDetails(bm, db)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		bm.Position = policy.startOffset(url)
+	}
+	bm.scanFile()
+	if bm.Exists() && bm.chaptersDirty {
+		err = saveChapters(bm, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bm, nil
 }
 
 func GetMostRecentBookmark(db *sql.DB) (*Bookmark, error) {
+	return GetMostRecentTaggedBookmark(db, "")
+}
+
+// GetMostRecentTaggedBookmark returns the most recent unfinished bookmark with
+// the tag or of all bookmarks if the tag is empty.
+func GetMostRecentTaggedBookmark(db *sql.DB, tag string) (*Bookmark, error) {
 	stmt, err := db.Prepare(`
-    select id, url, position, hash, inode, mtime, length, finished, updated,
-        created
+    select ` + bookmarkColumns + `
     from bookmarks
-    where finished == 0
+    where finished == 0 and ` + tagFilter + `
     order by updated desc
     limit 1;
     `)
 	if err != nil {
 		return nil, err
 	}
-	var url string
-	bookmark := Bookmark{}
-	row := stmt.QueryRow()
-	err = row.Scan(&bookmark.Id, &url, &bookmark.Position, &bookmark.Hash,
-		&bookmark.Inode, &bookmark.Mtime, &bookmark.Length, &bookmark.Finished,
-		&bookmark.Updated, &bookmark.Created)
+	bookmark, err := scanBookmark(stmt.QueryRow(tag, tag))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -215,27 +321,27 @@ func GetMostRecentBookmark(db *sql.DB) (*Bookmark, error) {
 		return nil, err
 	}
 
-	parsedUrl, err := ParseXesamUrl(url)
+	err = loadDetails(bookmark, db)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	bookmark.Url = parsedUrl
 
-	return &bookmark, nil
+	return bookmark, nil
 }
 
 func createBookmark(bm *Bookmark, db *sql.DB) error {
 	now := time.Now().Unix()
 	stmt, err := db.Prepare(`
     insert into bookmarks (url, position, hash, inode, mtime, length, finished,
-        created, updated)
-    values(?, ?, ?, ?, ?, ?, ?, ?, ?);
+        created, updated, title, artist, album, notes, player_cmd)
+    values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
     `)
 	if err != nil {
 		return err
 	}
 	result, err := stmt.Exec(bm.Url.String(), bm.Position, bm.Hash, bm.Inode, bm.Mtime,
-		bm.Length, bm.Finished, now, now)
+		bm.Length, bm.Finished, now, now, bm.Title, bm.Artist, bm.Album, bm.Notes,
+		bm.PlayerCmd)
 	if err != nil {
 		return err
 	}
@@ -262,7 +368,8 @@ func updateBookmark(bm *Bookmark, db *sql.DB) error {
 	stmt, err := db.Prepare(`
     update bookmarks
     set url = ?, position = ?, hash = ?, inode = ?, mtime = ?, length = ?,
-        finished = ?, updated = ?
+        finished = ?, updated = ?, title = ?, artist = ?, album = ?, notes = ?,
+        player_cmd = ?
     where id = ?;
     `)
 	if err != nil {
@@ -270,7 +377,8 @@ func updateBookmark(bm *Bookmark, db *sql.DB) error {
 	}
 
 	_, err = stmt.Exec(bm.Url.String(), bm.Position, bm.Hash, bm.Inode, bm.Mtime,
-		bm.Length, bm.Finished, now, bm.Id)
+		bm.Length, bm.Finished, now, bm.Title, bm.Artist, bm.Album, bm.Notes,
+		bm.PlayerCmd, bm.Id)
 	if err != nil {
 		return err
 	}
@@ -278,21 +386,72 @@ func updateBookmark(bm *Bookmark, db *sql.DB) error {
 	return nil
 }
 
+// IsAtEnd is whether the bookmark is finished at the position by the
+// completion policy for its url.
+func (bm *Bookmark) IsAtEnd(position int64) bool {
+	return bm.policy.completion(bm.Url).IsFinished(bm, position)
+}
+
+// Save saves the bookmark unless the policy it was loaded with says the file
+// is too short to bookmark.
 func (bm *Bookmark) Save(db *sql.DB) error {
+	if !bm.policy.keeps(bm) {
+		return nil
+	}
+
 	if bm.Length > 0 {
-		if abs(bm.Length-bm.Position) < finishedThreshold || bm.Position > bm.Length {
+		if bm.IsAtEnd(bm.Position) {
 			bm.Finished = 1
-			bm.Position = 0
+			if !bm.policy.keepsFinishedPosition() {
+				bm.Position = 0
+			}
 		} else {
 			bm.Finished = 0
 		}
 	}
 
+	var err error
 	if bm.needsCreate {
-		return createBookmark(bm, db)
+		err = createBookmark(bm, db)
+		if err == nil {
+			err = applyTagRules(bm, db)
+		}
 	} else {
-		return updateBookmark(bm, db)
+		err = updateBookmark(bm, db)
+	}
+	if err != nil {
+		return err
+	}
+
+	if bm.chaptersDirty {
+		err = saveChapters(bm, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	if bm.listenedDirty {
+		err = saveListened(bm, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	if bm.settingsDirty {
+		err = saveSettings(bm, db)
+		if err != nil {
+			return err
+		}
 	}
+
+	if bm.Finished == 1 {
+		err = dequeueFinished(bm, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	return indexBookmark(bm, db)
 }
 
 func (bm *Bookmark) Delete(db *sql.DB) error {
@@ -305,6 +464,33 @@ func (bm *Bookmark) Delete(db *sql.DB) error {
 		return err
 	}
 	_, err = stmt.Exec(bm.Id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`delete from chapters where bookmark_id = ?;`, bm.Id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`delete from bookmark_tags where bookmark_id = ?;`, bm.Id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`delete from skip_segments where bookmark_id = ?;`, bm.Id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`delete from listened where bookmark_id = ?;`, bm.Id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`delete from settings where bookmark_id = ?;`, bm.Id)
+	if err != nil {
+		return err
+	}
+	err = unindexBookmark(bm.Id, db)
+	if err != nil {
+		return err
+	}
 	bm.Id = 0
 	bm.needsCreate = true
 	return nil
@@ -26,7 +26,7 @@ func TestBookmarkSave(t *testing.T) {
 	defer db.Close()
 
 	url, err := ParseXesamUrl("file://" + f.Name())
-	bm, err := GetBookmark(db, url)
+	bm, err := GetBookmark(db, url, nil)
 	require.NoError(t, err)
 	require.NotNil(t, bm)
 	t.Log(bm)
@@ -47,7 +47,7 @@ func TestBookmarkSave(t *testing.T) {
 	bm.Length = int64(1e+10)
 	bm.Save(db)
 	url, err = ParseXesamUrl("file://" + f.Name())
-	bm, err = GetBookmark(db, url)
+	bm, err = GetBookmark(db, url, nil)
 	require.NoError(t, err)
 	require.Equal(t, bm.Position, int64(0),
 		"The position should be reset to zero if the bookmark is at the end")
@@ -73,7 +73,7 @@ func TestBookmarkSave(t *testing.T) {
 	defer f.Close()
 	url, err = ParseXesamUrl("file://" + f.Name())
 	require.NoError(t, err)
-	recentBm, err := GetBookmark(db, url)
+	recentBm, err := GetBookmark(db, url, nil)
 	require.NoError(t, err)
 	err = recentBm.Save(db)
 	require.NoError(t, err)
@@ -107,13 +107,87 @@ func TestOtherSchemeBookmarks(t *testing.T) {
 	url, err := ParseXesamUrl("http://example.com/movie.mp4")
 	require.NoError(t, err)
 
-	bookmark, err := GetBookmark(db, url)
+	bookmark, err := GetBookmark(db, url, nil)
 	require.NoError(t, err)
 	err = bookmark.Save(db)
 	require.NoError(t, err)
 	require.Equal(t, bookmark.Url.String(), url.String())
 	require.NotEqual(t, bookmark.Id, int64(0))
 
-	bookmark2, err := GetBookmark(db, url)
+	bookmark2, err := GetBookmark(db, url, nil)
 	require.Equal(t, bookmark, bookmark2)
 }
+
+func TestBookmarkChapters(t *testing.T) {
+	// an ID3v2.3 tag with one CHAP frame starting at 1:30 titled "The Battle"
+	title := append([]byte("TIT2\x00\x00\x00\x0b\x00\x00\x03"), "The Battle"...)
+	chap := append([]byte("ch0\x00\x00\x01\x5f\x90"), make([]byte, 12)...)
+	chap = append(chap, title...)
+	frame := append([]byte{'C', 'H', 'A', 'P', 0, 0, 0, byte(len(chap)), 0, 0}, chap...)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frame))}, frame...)
+
+	f, err := ioutil.TempFile("", "pbm-track")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(tag)
+	require.NoError(t, err)
+	f.Close()
+
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	url, err := ParseXesamUrl("file://" + f.Name())
+	require.NoError(t, err)
+	bm, err := GetBookmark(db, url, nil)
+	require.NoError(t, err)
+	require.Equal(t, []Chapter{{Position: int64(90e+6), Title: "The Battle"}}, bm.Chapters)
+	require.Equal(t, "", bm.CurrentChapter(), "The position is before the first chapter")
+
+	bm.Position = int64(100e+6)
+	require.NoError(t, bm.Save(db))
+	require.Equal(t, "Chapter 1: The Battle", bm.CurrentChapter())
+
+	bookmarks, err := ListBookmarks(db)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(bookmarks))
+	require.Equal(t, bm.Chapters, bookmarks[0].Chapters,
+		"The chapters should be stored with the bookmark")
+}
+
+func TestBookmarkCueSheet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbm-cue")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := dir + "/mix.mp3"
+	require.NoError(t, ioutil.WriteFile(path, []byte(uuid.New().String()), 0644))
+	cue := "FILE \"mix.mp3\" MP3\n" +
+		"  TRACK 01 AUDIO\n    TITLE \"First\"\n    INDEX 01 00:00:00\n" +
+		"  TRACK 02 AUDIO\n    TITLE \"Second\"\n    INDEX 01 02:00:00\n"
+	require.NoError(t, ioutil.WriteFile(dir+"/mix.cue", []byte(cue), 0644))
+
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	url, err := ParseXesamUrl("file://" + path)
+	require.NoError(t, err)
+	bm, err := GetBookmark(db, url, nil)
+	require.NoError(t, err)
+	bm.Position = int64(150e+6)
+	require.NoError(t, bm.Save(db))
+	require.Equal(t, "Track 2: Second", bm.CurrentChapter(),
+		"The tracks of a sibling cue sheet should be used as chapters")
+	require.Equal(t, int64(120e+6), bm.Chapters[1].Position)
+
+	otherPath := dir + "/other.mp3"
+	require.NoError(t, ioutil.WriteFile(otherPath, []byte(uuid.New().String()), 0644))
+	other, err := ParseXesamUrl("file://" + otherPath)
+	require.NoError(t, err)
+	otherBm, err := GetBookmark(db, other, nil)
+	require.NoError(t, err)
+	require.Empty(t, otherBm.Chapters)
+	require.Equal(t, "", otherBm.chaptersSource,
+		"A cue sheet without tracks for the file should not be the source of its chapters")
+}
@@ -0,0 +1,214 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/altdesktop/playerbm/internal/media"
+	"log"
+)
+
+const (
+	chaptersFromFile = "file"
+	chaptersFromCue  = "cue"
+)
+
+// A Chapter is a named section of a file. It is either a chapter embedded in
+// the file or a track of a cue sheet for the file.
+type Chapter struct {
+	Position int64
+	Title    string
+}
+
+// ChapterName is how the chapter at index i is shown to the user.
+func (bm *Bookmark) ChapterName(i int) string {
+	kind := "Chapter"
+	if bm.chaptersSource == chaptersFromCue {
+		kind = "Track"
+	}
+
+	title := bm.Chapters[i].Title
+	if len(title) == 0 {
+		return fmt.Sprintf("%s %d", kind, i+1)
+	}
+	return fmt.Sprintf("%s %d: %s", kind, i+1, title)
+}
+
+// ChapterIndex returns the index of the chapter that contains the position or
+// -1 if there is no such chapter.
+func (bm *Bookmark) ChapterIndex(position int64) int {
+	index := -1
+	for i, chapter := range bm.Chapters {
+		if chapter.Position > position {
+			break
+		}
+		index = i
+	}
+	return index
+}
+
+// ChapterEnd returns the position where the chapter at index i ends or 0 if
+// it is the last chapter and the length is not known.
+func (bm *Bookmark) ChapterEnd(i int) int64 {
+	if i+1 < len(bm.Chapters) {
+		return bm.Chapters[i+1].Position
+	}
+	return bm.Length
+}
+
+// CurrentChapter returns the name of the chapter at the bookmark position or
+// an empty string if the file does not have chapters.
+func (bm *Bookmark) CurrentChapter() string {
+	i := bm.ChapterIndex(bm.Position)
+	if i == -1 {
+		return ""
+	}
+	return bm.ChapterName(i)
+}
+
+// scanFile reads the chapters and tags from the file or the chapters from its
+// cue sheet if either of them has changed since they were last read. Chapters
+// embedded in the file take precedence over the cue sheet.
+func (bm *Bookmark) scanFile() {
+	if bm.Url.Scheme() != "file" {
+		return
+	}
+	path := bm.Url.UnescapedPath()
+
+	// the cue sheets are only read when one of them or the directory changed
+	cueMtime, err := media.CueSheetsMtime(path)
+	if err != nil {
+		log.Printf("[DEBUG] could not look for cue sheets: %+v", err)
+	}
+
+	if bm.chaptersMtime == bm.Mtime && bm.cueMtime == cueMtime {
+		return
+	}
+
+	log.Printf("[DEBUG] reading chapters from file")
+	bm.Chapters = nil
+	bm.chaptersSource = ""
+	bm.chaptersMtime = bm.Mtime
+	bm.cueMtime = cueMtime
+	bm.chaptersDirty = true
+
+	info, err := media.Probe(path)
+	if err != nil {
+		log.Printf("[DEBUG] could not read chapters: %+v", err)
+	} else {
+		for _, chapter := range info.Chapters {
+			bm.Chapters = append(bm.Chapters, Chapter{Position: chapter.Start, Title: chapter.Title})
+		}
+		if len(bm.Chapters) > 0 {
+			bm.chaptersSource = chaptersFromFile
+		}
+
+		// tags from the player take precedence
+		if len(bm.Title) == 0 {
+			bm.Title = info.Title
+		}
+		if len(bm.Artist) == 0 {
+			bm.Artist = info.Artist
+		}
+		if len(bm.Album) == 0 {
+			bm.Album = info.Album
+		}
+	}
+
+	if len(bm.Chapters) == 0 && cueMtime > 0 {
+		bm.readCueSheet(path)
+	}
+
+	log.Printf("[DEBUG] found %d chapters", len(bm.Chapters))
+}
+
+// readCueSheet uses the tracks of the cue sheet for the file as chapters.
+func (bm *Bookmark) readCueSheet(path string) {
+	cuePath, err := media.FindCueSheet(path)
+	if err != nil {
+		log.Printf("[DEBUG] could not look for a cue sheet: %+v", err)
+	}
+	if len(cuePath) == 0 {
+		return
+	}
+
+	log.Printf("[DEBUG] reading chapters from cue sheet: %s", cuePath)
+	tracks, err := media.ReadCueSheet(cuePath, path)
+	if err != nil {
+		log.Printf("[DEBUG] could not read cue sheet: %+v", err)
+	}
+	for _, track := range tracks {
+		bm.Chapters = append(bm.Chapters, Chapter{Position: track.Start, Title: track.Title})
+	}
+	if len(bm.Chapters) > 0 {
+		bm.chaptersSource = chaptersFromCue
+	}
+}
+
+func loadChapters(bm *Bookmark, db *sql.DB) error {
+	rows, err := db.Query(`
+    select position, title
+    from chapters
+    where bookmark_id = ?
+    order by position
+    `, bm.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	bm.Chapters = nil
+	for rows.Next() {
+		chapter := Chapter{}
+		err = rows.Scan(&chapter.Position, &chapter.Title)
+		if err != nil {
+			return err
+		}
+		bm.Chapters = append(bm.Chapters, chapter)
+	}
+
+	return rows.Err()
+}
+
+func saveChapters(bm *Bookmark, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`delete from chapters where bookmark_id = ?;`, bm.Id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, chapter := range bm.Chapters {
+		_, err = tx.Exec(`
+        insert into chapters (bookmark_id, position, title)
+        values(?, ?, ?);
+        `, bm.Id, chapter.Position, chapter.Title)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+    update bookmarks
+    set chapters_mtime = ?, chapters_source = ?, cue_mtime = ?, title = ?,
+        artist = ?, album = ?
+    where id = ?;
+    `, bm.chaptersMtime, bm.chaptersSource, bm.cueMtime, bm.Title, bm.Artist,
+		bm.Album, bm.Id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	bm.chaptersDirty = false
+	return indexBookmark(bm, db)
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"github.com/altdesktop/playerbm/internal/media"
+	"strings"
+)
+
+// A CompletionPolicy decides whether a bookmark is finished at a position.
+type CompletionPolicy interface {
+	IsFinished(bm *Bookmark, position int64) bool
+}
+
+// ThresholdCompletion finishes a file within an absolute time of the end.
+type ThresholdCompletion struct {
+	Threshold int64
+}
+
+func (c *ThresholdCompletion) IsFinished(bm *Bookmark, position int64) bool {
+	if bm.Length <= 0 {
+		return false
+	}
+	return abs(bm.Length-position) < c.Threshold || position > bm.Length
+}
+
+// PercentCompletion finishes a file when the position is past a percent of
+// the length, which works for both short tracks and movies with long credits.
+type PercentCompletion struct {
+	Percent float64
+}
+
+func (c *PercentCompletion) IsFinished(bm *Bookmark, position int64) bool {
+	if bm.Length <= 0 {
+		return false
+	}
+	return float64(position)*100 >= c.Percent*float64(bm.Length)
+}
+
+// MediaTypeCompletion uses a different policy for video and audio files,
+// which are told apart by the extension or else by the MIME type of the
+// content. Files that are neither use the Other policy.
+type MediaTypeCompletion struct {
+	Video CompletionPolicy
+	Audio CompletionPolicy
+	Other CompletionPolicy
+}
+
+func (c *MediaTypeCompletion) IsFinished(bm *Bookmark, position int64) bool {
+	policy := c.Other
+	if bm.Url.Scheme() == "file" {
+		path := bm.Url.UnescapedPath()
+		if media.IsVideoFile(path) {
+			policy = c.Video
+		} else if media.IsMediaFile(path) {
+			policy = c.Audio
+		} else {
+			mimeType := media.DetectMimeType(path)
+			if strings.HasPrefix(mimeType, "video/") {
+				policy = c.Video
+			} else if strings.HasPrefix(mimeType, "audio/") {
+				policy = c.Audio
+			}
+		}
+	}
+	if policy == nil {
+		policy = defaultCompletion
+	}
+	return policy.IsFinished(bm, position)
+}
+
+var defaultCompletion CompletionPolicy = &ThresholdCompletion{Threshold: finishedThreshold}
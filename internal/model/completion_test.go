@@ -0,0 +1,74 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompletionPolicies(t *testing.T) {
+	movie := &Bookmark{Url: FileUrl("/videos/movie.mkv"), Length: int64(6000e+6)}
+	song := &Bookmark{Url: FileUrl("/music/song.mp3"), Length: int64(180e+6)}
+
+	threshold := &ThresholdCompletion{Threshold: int64(10e+6)}
+	require.True(t, threshold.IsFinished(song, int64(175e+6)))
+	require.False(t, threshold.IsFinished(song, int64(160e+6)))
+	require.False(t, threshold.IsFinished(&Bookmark{}, 0), "Files without a length should never finish")
+
+	percent := &PercentCompletion{Percent: 90}
+	require.True(t, percent.IsFinished(movie, int64(5500e+6)), "The credits of a movie should not need to play")
+	require.False(t, percent.IsFinished(movie, int64(5000e+6)))
+
+	byType := &MediaTypeCompletion{Video: percent, Audio: threshold}
+	require.True(t, byType.IsFinished(movie, int64(5500e+6)))
+	require.False(t, byType.IsFinished(song, int64(165e+6)))
+	require.True(t, byType.IsFinished(song, int64(175e+6)))
+}
+
+func TestMediaTypeCompletionByContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbm-completion")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	videoPath := filepath.Join(dir, "recording")
+	require.NoError(t, ioutil.WriteFile(videoPath, append([]byte{0x1a, 0x45, 0xdf, 0xa3}, "\x00\x00\x00\x00webm"...), 0644))
+	audioPath := filepath.Join(dir, "episode")
+	require.NoError(t, ioutil.WriteFile(audioPath, []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), 0644))
+
+	byType := &MediaTypeCompletion{
+		Video: &PercentCompletion{Percent: 90},
+		Audio: &ThresholdCompletion{Threshold: int64(10e+6)},
+	}
+	video := &Bookmark{Url: FileUrl(videoPath), Length: int64(6000e+6)}
+	require.True(t, byType.IsFinished(video, int64(5500e+6)), "Files without an extension should be told apart by their content")
+	audio := &Bookmark{Url: FileUrl(audioPath), Length: int64(6000e+6)}
+	require.False(t, byType.IsFinished(audio, int64(5500e+6)))
+	require.True(t, byType.IsFinished(audio, int64(5995e+6)))
+}
+
+func TestKeepFinishedPosition(t *testing.T) {
+	f := createTmpFile(t)
+	defer os.Remove(f.Name())
+
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	policy := &Policy{
+		Completion:           &PercentCompletion{Percent: 95},
+		KeepFinishedPosition: true,
+	}
+	bm, err := GetBookmark(db, FileUrl(f.Name()), policy)
+	require.NoError(t, err)
+	bm.Length = int64(100e+6)
+	bm.Position = int64(96e+6)
+	require.NoError(t, bm.Save(db))
+	require.Equal(t, 1, bm.Finished)
+
+	bm, err = GetBookmark(db, FileUrl(f.Name()), policy)
+	require.NoError(t, err)
+	require.Equal(t, 1, bm.Finished)
+	require.Equal(t, int64(96e+6), bm.Position, "The final position should be kept")
+}
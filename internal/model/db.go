@@ -8,12 +8,150 @@ import (
 	"log"
 )
 
+type migration func(tx *sql.Tx) error
+
+func execMigration(stmt string) migration {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(stmt)
+		return err
+	}
+}
+
+// The schema is created by running each migration in order. The user_version
+// of the database is the number of migrations that have been applied, so new
+// migrations must only ever be added to the end of this list.
+var migrations = []migration{
+	execMigration(`
+    CREATE TABLE bookmarks (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        url TEXT,
+        position INTEGER,
+        length INTEGER,
+        hash TEXT,
+        inode TEXT, -- uint64
+        mtime INTEGER,
+        finished INTEGER, -- boolean
+        created INTEGER,
+        updated INTEGER
+    );
+    `),
+	execMigration(`
+    CREATE TABLE chapters (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        bookmark_id INTEGER NOT NULL,
+        position INTEGER,
+        title TEXT
+    );
+    CREATE INDEX chapters_bookmark_id ON chapters (bookmark_id);
+    -- the mtime of the file when the chapters were read
+    ALTER TABLE bookmarks ADD COLUMN chapters_mtime INTEGER NOT NULL DEFAULT 0;
+    `),
+	execMigration(`
+    -- where the chapters were read from and the mtime of the cue sheet
+    ALTER TABLE bookmarks ADD COLUMN chapters_source TEXT NOT NULL DEFAULT '';
+    ALTER TABLE bookmarks ADD COLUMN cue_mtime INTEGER NOT NULL DEFAULT 0;
+    `),
+	migrateSearch,
+	execMigration(`
+    CREATE TABLE tags (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        name TEXT NOT NULL UNIQUE COLLATE NOCASE
+    );
+    CREATE TABLE bookmark_tags (
+        bookmark_id INTEGER NOT NULL,
+        tag_id INTEGER NOT NULL,
+        PRIMARY KEY (bookmark_id, tag_id)
+    );
+    CREATE TABLE tag_rules (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        tag_id INTEGER NOT NULL,
+        prefix TEXT NOT NULL,
+        UNIQUE (tag_id, prefix)
+    );
+    `),
+	execMigration(`
+    CREATE TABLE queue (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        url TEXT NOT NULL UNIQUE,
+        position INTEGER NOT NULL
+    );
+    `),
+	execMigration(`
+    CREATE TABLE sessions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        urls TEXT NOT NULL UNIQUE, -- newline separated in playlist order
+        current INTEGER NOT NULL,
+        position INTEGER NOT NULL,
+        player_cmd TEXT NOT NULL,
+        created INTEGER NOT NULL,
+        updated INTEGER NOT NULL
+    );
+    `),
+	execMigration(`
+    -- segments belong to a bookmark or are the defaults for a directory
+    CREATE TABLE skip_segments (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        bookmark_id INTEGER NOT NULL DEFAULT 0,
+        dir TEXT NOT NULL DEFAULT '',
+        start_position INTEGER NOT NULL,
+        end_position INTEGER NOT NULL
+    );
+    CREATE INDEX skip_segments_bookmark_id ON skip_segments (bookmark_id);
+    `),
+	execMigration(`
+    CREATE TABLE listened (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        bookmark_id INTEGER NOT NULL,
+        start_position INTEGER NOT NULL,
+        end_position INTEGER NOT NULL
+    );
+    CREATE INDEX listened_bookmark_id ON listened (bookmark_id);
+    `),
+	execMigration(`
+    CREATE TABLE settings (
+        id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+        bookmark_id INTEGER NOT NULL,
+        name TEXT NOT NULL,
+        value TEXT NOT NULL,
+        pinned INTEGER NOT NULL DEFAULT 0,
+        UNIQUE(bookmark_id, name)
+    );
+    `),
+	execMigration(`
+    ALTER TABLE bookmarks ADD COLUMN player_cmd TEXT NOT NULL DEFAULT '';
+    `),
+}
+
+func migrate(db *sql.DB, version int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = migrations[version](tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func InitDb(path string) (*sql.DB, error) {
 	log.Printf("[DEBUG] connecting to database at: %s", path)
 	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		return nil, err
 	}
+	// each connection to an in-memory database is a different database
+	db.SetMaxOpenConns(1)
+
 	versionRow := db.QueryRow("PRAGMA user_version")
 	if err != nil {
 		return nil, err
@@ -23,33 +161,27 @@ func InitDb(path string) (*sql.DB, error) {
 	versionRow.Scan(&version)
 	log.Printf("[DEBUG] database version: %d", version)
 
-	if version > 1 {
+	if version > len(migrations) {
 		msg := fmt.Sprintf("Got unknown database version: %d", version)
 		return nil, errors.New(msg)
 	}
 
 	if version == 0 {
 		log.Printf("[DEBUG] initializing database for the first time")
-		createStmt := `
-        CREATE TABLE bookmarks (
-            id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
-            url TEXT,
-            position INTEGER,
-            length INTEGER,
-            hash TEXT,
-            inode TEXT, -- uint64
-            mtime INTEGER,
-            finished INTEGER, -- boolean
-            created INTEGER,
-            updated INTEGER
-        );
-        PRAGMA user_version = 1;
-        `
-		_, err = db.Exec(createStmt)
+	}
+
+	for version < len(migrations) {
+		log.Printf("[DEBUG] migrating database to version %d", version+1)
+		err = migrate(db, version)
 		if err != nil {
 			return nil, err
 		}
-		version = 1
+		version++
+	}
+
+	err = ensureSearchIndex(db)
+	if err != nil {
+		return nil, err
 	}
 
 	return db, nil
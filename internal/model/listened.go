@@ -0,0 +1,147 @@
+package model
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// Gaps shorter than this are left over from seeking and are not reported.
+const minGapLength = int64(2e+6)
+
+func loadListened(bm *Bookmark, db *sql.DB) error {
+	rows, err := db.Query(`
+    select start_position, end_position
+    from listened
+    where bookmark_id = ?
+    order by start_position
+    `, bm.Id)
+	if err != nil {
+		return err
+	}
+
+	bm.Listened, err = scanSegments(rows)
+	return err
+}
+
+func saveListened(bm *Bookmark, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`delete from listened where bookmark_id = ?;`, bm.Id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, segment := range bm.Listened {
+		_, err = tx.Exec(`
+        insert into listened (bookmark_id, start_position, end_position)
+        values(?, ?, ?);
+        `, bm.Id, segment.Start, segment.End)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	bm.listenedDirty = false
+	return nil
+}
+
+// mergeSegments sorts the segments and joins the ones that overlap or touch.
+func mergeSegments(segments []Segment) []Segment {
+	sorted := make([]Segment, len(segments))
+	copy(sorted, segments)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	var merged []Segment
+	for _, segment := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && segment.Start <= merged[last].End {
+			if segment.End > merged[last].End {
+				merged[last].End = segment.End
+			}
+			continue
+		}
+		merged = append(merged, segment)
+	}
+
+	return merged
+}
+
+// AddListened records that the segment of the file was played. It is saved
+// with the bookmark.
+func (bm *Bookmark) AddListened(segment Segment) {
+	if segment.Start < 0 {
+		segment.Start = 0
+	}
+	if bm.Length > 0 && segment.End > bm.Length {
+		segment.End = bm.Length
+	}
+	if segment.End <= segment.Start {
+		return
+	}
+
+	bm.Listened = mergeSegments(append(bm.Listened, segment))
+	bm.listenedDirty = true
+}
+
+// Coverage is the percent of the file that was listened to.
+func (bm *Bookmark) Coverage() float64 {
+	if bm.Length <= 0 {
+		return 0
+	}
+	var listened int64
+	for _, segment := range bm.Listened {
+		listened += segment.End - segment.Start
+	}
+	return float64(listened) * 100 / float64(bm.Length)
+}
+
+// CoverageCompletion finishes a file at its end only when a percent of it was
+// listened to, so seeking to the end does not finish it. The End policy says
+// where the end is and defaults to the usual threshold.
+type CoverageCompletion struct {
+	Percent float64
+	End     CompletionPolicy
+}
+
+func (c *CoverageCompletion) IsFinished(bm *Bookmark, position int64) bool {
+	end := c.End
+	if end == nil {
+		end = defaultCompletion
+	}
+	return end.IsFinished(bm, position) && bm.Coverage() >= c.Percent
+}
+
+// Gaps are the parts of the file that were not listened to.
+func (bm *Bookmark) Gaps() []Segment {
+	gaps := []Segment{}
+	if bm.Length <= 0 {
+		return gaps
+	}
+
+	var position int64
+	for _, segment := range bm.Listened {
+		if segment.Start-position >= minGapLength {
+			gaps = append(gaps, Segment{Start: position, End: segment.Start})
+		}
+		if segment.End > position {
+			position = segment.End
+		}
+	}
+	if bm.Length-position >= minGapLength {
+		gaps = append(gaps, Segment{Start: position, End: bm.Length})
+	}
+
+	return gaps
+}
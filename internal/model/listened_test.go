@@ -0,0 +1,58 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestListened(t *testing.T) {
+	f := createTmpFile(t)
+	defer os.Remove(f.Name())
+
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	bm, err := GetBookmark(db, FileUrl(f.Name()), nil)
+	require.NoError(t, err)
+	bm.Length = int64(100e+6)
+	bm.AddListened(Segment{Start: int64(50e+6), End: int64(60e+6)})
+	bm.AddListened(Segment{Start: 0, End: int64(20e+6)})
+	bm.AddListened(Segment{Start: int64(10e+6), End: int64(30e+6)})
+	bm.AddListened(Segment{Start: int64(99e+6), End: int64(120e+6)})
+	bm.AddListened(Segment{Start: int64(5e+6), End: int64(5e+6)})
+	require.Equal(t, []Segment{
+		{Start: 0, End: int64(30e+6)},
+		{Start: int64(50e+6), End: int64(60e+6)},
+		{Start: int64(99e+6), End: int64(100e+6)},
+	}, bm.Listened, "Overlapping segments should be merged and clamped to the length")
+
+	bm.Position = int64(60e+6)
+	require.NoError(t, bm.Save(db))
+
+	bm, err = GetBookmark(db, FileUrl(f.Name()), nil)
+	require.NoError(t, err)
+	require.Len(t, bm.Listened, 3)
+	require.InDelta(t, 41, bm.Coverage(), 0.001)
+	require.Equal(t, []Segment{
+		{Start: int64(30e+6), End: int64(50e+6)},
+		{Start: int64(60e+6), End: int64(99e+6)},
+	}, bm.Gaps())
+
+	require.NoError(t, bm.Delete(db))
+	var count int
+	require.NoError(t, db.QueryRow(`select count(*) from listened`).Scan(&count))
+	require.Equal(t, 0, count, "Deleting the bookmark should delete what was listened to")
+}
+
+func TestCoverageCompletion(t *testing.T) {
+	song := &Bookmark{Url: FileUrl("/music/song.mp3"), Length: int64(180e+6)}
+	coverage := &CoverageCompletion{Percent: 80}
+
+	song.Listened = []Segment{{Start: 0, End: int64(30e+6)}}
+	require.False(t, coverage.IsFinished(song, int64(179e+6)), "Seeking to the end should not finish the file")
+	song.Listened = []Segment{{Start: 0, End: int64(100e+6)}, {Start: int64(120e+6), End: int64(180e+6)}}
+	require.False(t, coverage.IsFinished(song, int64(30e+6)), "A file that was mostly heard should not finish before its end")
+	require.True(t, coverage.IsFinished(song, int64(175e+6)))
+}
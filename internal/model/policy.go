@@ -0,0 +1,118 @@
+package model
+
+import (
+	"log"
+	"sort"
+)
+
+// A PathRule changes how bookmarks are kept for the files under a directory.
+// Fields that are zero are taken from rules for the directories above it.
+type PathRule struct {
+	Prefix string
+	// new files start at this position, for example to skip an intro
+	StartOffset int64
+	// files are finished within this time of the end instead of the default
+	FinishThreshold int64
+	// files shorter than this are never bookmarked
+	MinLength int64
+}
+
+// A Policy decides where new bookmarks start, when they are finished and
+// which files are bookmarked at all. A nil policy has no rules.
+type Policy struct {
+	Rules []PathRule
+	// decides when files are finished where no rule has a finish threshold
+	Completion CompletionPolicy
+	// finished bookmarks keep their position instead of going back to the
+	// start
+	KeepFinishedPosition bool
+	// how far to go back when a bookmark is resumed
+	Rewind *RewindPolicy
+	// the names of the settings that are not restored
+	NoRestore []string
+}
+
+// rule merges the rules that match the url with the rules for the deepest
+// directories taking precedence.
+func (policy *Policy) rule(url *XesamUrl) PathRule {
+	merged := PathRule{}
+	if policy == nil {
+		return merged
+	}
+
+	matching := []PathRule{}
+	for _, rule := range policy.Rules {
+		tagRule := TagRule{Prefix: rule.Prefix}
+		if tagRule.Matches(url) {
+			matching = append(matching, rule)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return len(matching[i].Prefix) < len(matching[j].Prefix)
+	})
+
+	for _, rule := range matching {
+		merged.Prefix = rule.Prefix
+		if rule.StartOffset > 0 {
+			merged.StartOffset = rule.StartOffset
+		}
+		if rule.FinishThreshold > 0 {
+			merged.FinishThreshold = rule.FinishThreshold
+		}
+		if rule.MinLength > 0 {
+			merged.MinLength = rule.MinLength
+		}
+	}
+
+	return merged
+}
+
+func (policy *Policy) startOffset(url *XesamUrl) int64 {
+	return policy.rule(url).StartOffset
+}
+
+func (policy *Policy) completion(url *XesamUrl) CompletionPolicy {
+	if threshold := policy.rule(url).FinishThreshold; threshold > 0 {
+		return &ThresholdCompletion{Threshold: threshold}
+	}
+	if policy != nil && policy.Completion != nil {
+		return policy.Completion
+	}
+	return defaultCompletion
+}
+
+func (policy *Policy) keepsFinishedPosition() bool {
+	return policy != nil && policy.KeepFinishedPosition
+}
+
+// keeps is whether the bookmark is long enough to be saved.
+func (policy *Policy) keeps(bm *Bookmark) bool {
+	rule := policy.rule(bm.Url)
+	if bm.Length > 0 && bm.Length < rule.MinLength {
+		log.Printf("[DEBUG] not saving bookmark shorter than %d for %s", rule.MinLength, rule.Prefix)
+		return false
+	}
+	return true
+}
+
+// RestoresSetting is whether the setting with the name is restored when a
+// bookmark is loaded.
+func (policy *Policy) RestoresSetting(name string) bool {
+	if policy == nil {
+		return true
+	}
+	for _, noRestore := range policy.NoRestore {
+		if noRestore == name {
+			return false
+		}
+	}
+	return true
+}
+
+type PolicyError struct {
+	err string
+}
+
+func (e *PolicyError) Error() string {
+	return e.err
+}
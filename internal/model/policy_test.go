@@ -0,0 +1,45 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	f := createTmpFile(t)
+	defer os.Remove(f.Name())
+
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	dir := filepath.Dir(f.Name())
+	policy := &Policy{Rules: []PathRule{
+		{Prefix: dir, StartOffset: int64(30e+6), FinishThreshold: int64(60e+6)},
+		{Prefix: "/", StartOffset: int64(5e+6), MinLength: int64(120e+6)},
+	}}
+
+	bm, err := GetBookmark(db, FileUrl(f.Name()), policy)
+	require.NoError(t, err)
+	require.Equal(t, int64(30e+6), bm.Position,
+		"New bookmarks should start at the offset of the deepest rule")
+
+	bm.Length = int64(100e+6)
+	require.NoError(t, bm.Save(db))
+	require.False(t, bm.Exists(), "Files shorter than the minimum length should not be saved")
+	require.Error(t, bm.AddTag(db, "short"))
+
+	bm.Length = int64(600e+6)
+	bm.Position = int64(550e+6)
+	require.True(t, bm.IsAtEnd(bm.Position), "The finish threshold of the rule should be used")
+	require.NoError(t, bm.Save(db))
+	require.True(t, bm.Exists())
+	require.Equal(t, 1, bm.Finished)
+
+	bm, err = GetBookmark(db, FileUrl(f.Name()), nil)
+	require.NoError(t, err)
+	require.False(t, bm.IsAtEnd(int64(550e+6)), "Without a policy the default threshold should be used")
+	require.Equal(t, int64(0), bm.Position, "Existing bookmarks should not use the start offset")
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"database/sql"
+	"log"
+)
+
+// The queue is an ordered list of urls to listen to next. Items are removed
+// from the queue when their bookmark is finished.
+
+func ListQueue(db *sql.DB) ([]*XesamUrl, error) {
+	rows, err := db.Query(`select url from queue order by position;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []*XesamUrl{}
+	for rows.Next() {
+		var url string
+		err = rows.Scan(&url)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := ParseXesamUrl(url)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, parsed)
+	}
+
+	return urls, rows.Err()
+}
+
+// QueueHead is the first url in the queue or nil if the queue is empty.
+func QueueHead(db *sql.DB) (*XesamUrl, error) {
+	var url string
+	err := db.QueryRow(`select url from queue order by position limit 1;`).Scan(&url)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseXesamUrl(url)
+}
+
+func IsQueued(db queryer, url *XesamUrl) (bool, error) {
+	var count int
+	err := db.QueryRow(`select count(*) from queue where url = ?;`, url.String()).Scan(&count)
+	return count > 0, err
+}
+
+// QueueAdd adds the url to the end of the queue. A url that is already in the
+// queue keeps its place.
+func QueueAdd(db *sql.DB, url *XesamUrl) error {
+	_, err := db.Exec(`
+    insert or ignore into queue (url, position)
+    values(?, (select coalesce(max(position), 0) + 1 from queue));
+    `, url.String())
+	return err
+}
+
+func QueueRemove(db queryer, url *XesamUrl) error {
+	_, err := db.Exec(`delete from queue where url = ?;`, url.String())
+	return err
+}
+
+// QueueMove moves the url to the index in the queue counting from zero.
+func QueueMove(db *sql.DB, url *XesamUrl, index int) error {
+	urls, err := ListQueue(db)
+	if err != nil {
+		return err
+	}
+
+	from := -1
+	for i, queued := range urls {
+		if queued.String() == url.String() {
+			from = i
+			break
+		}
+	}
+	if from == -1 {
+		return &QueueError{err: "not in the queue: " + url.String()}
+	}
+
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(urls) {
+		index = len(urls) - 1
+	}
+
+	moved := urls[from]
+	urls = append(urls[:from], urls[from+1:]...)
+	urls = append(urls[:index], append([]*XesamUrl{moved}, urls[index:]...)...)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for i, queued := range urls {
+		_, err = tx.Exec(`update queue set position = ? where url = ?;`, i+1, queued.String())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type QueueError struct {
+	err string
+}
+
+func (e *QueueError) Error() string {
+	return e.err
+}
+
+// dequeueFinished moves the queue on when the bookmark of an item is
+// finished.
+func dequeueFinished(bm *Bookmark, db *sql.DB) error {
+	queued, err := IsQueued(db, bm.Url)
+	if err != nil || !queued {
+		return err
+	}
+	log.Printf("[DEBUG] removing finished bookmark from the queue: %s", bm.Url)
+	return QueueRemove(db, bm.Url)
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	f := createTmpFile(t)
+	defer os.Remove(f.Name())
+
+	urls := []*XesamUrl{FileUrl(f.Name())}
+	for _, s := range []string{"https://example.com/one.mp3", "https://example.com/two.mp3"} {
+		url, err := ParseXesamUrl(s)
+		require.NoError(t, err)
+		urls = append(urls, url)
+	}
+
+	for _, url := range urls {
+		require.NoError(t, QueueAdd(db, url))
+	}
+	require.NoError(t, QueueAdd(db, urls[1]), "Adding a queued url again should keep its place")
+
+	queue, err := ListQueue(db)
+	require.NoError(t, err)
+	require.Len(t, queue, 3)
+	require.Equal(t, urls[0].String(), queue[0].String())
+
+	require.NoError(t, QueueMove(db, urls[2], 0))
+	head, err := QueueHead(db)
+	require.NoError(t, err)
+	require.Equal(t, urls[2].String(), head.String())
+
+	require.NoError(t, QueueRemove(db, urls[2]))
+	head, err = QueueHead(db)
+	require.NoError(t, err)
+	require.Equal(t, urls[0].String(), head.String())
+
+	// finishing the bookmark moves the queue on
+	bm, err := GetBookmark(db, urls[0], nil)
+	require.NoError(t, err)
+	bm.Length = int64(100e+6)
+	bm.Position = int64(100e+6)
+	require.NoError(t, bm.Save(db))
+
+	head, err = QueueHead(db)
+	require.NoError(t, err)
+	require.Equal(t, urls[1].String(), head.String())
+
+	require.NoError(t, QueueRemove(db, urls[1]))
+	head, err = QueueHead(db)
+	require.NoError(t, err)
+	require.Nil(t, head)
+}
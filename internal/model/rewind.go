@@ -0,0 +1,60 @@
+package model
+
+import (
+	"github.com/altdesktop/playerbm/internal/media"
+	"math"
+	"time"
+)
+
+// A RewindPolicy goes back a little from the saved position when a bookmark
+// is resumed to pick up the thread again. The rewind grows from Min right
+// after a pause to Max after being away for MaxAfter or longer.
+type RewindPolicy struct {
+	Min      int64
+	Max      int64
+	MaxAfter time.Duration
+	// rewind to the start of the chapter the position is in
+	SnapChapter bool
+	// do not rewind video files
+	SkipVideo bool
+}
+
+// rewindAmount is how far to rewind after being away for the duration. It
+// grows quickly at first and then slowly like the memory of where we were.
+func (rewind *RewindPolicy) rewindAmount(away time.Duration) int64 {
+	if away <= 0 || rewind.MaxAfter <= 0 || rewind.Max <= rewind.Min {
+		return rewind.Min
+	}
+	if away >= rewind.MaxAfter {
+		return rewind.Max
+	}
+
+	scale := math.Log1p(away.Minutes()) / math.Log1p(rewind.MaxAfter.Minutes())
+	return rewind.Min + int64(scale*float64(rewind.Max-rewind.Min))
+}
+
+// ResumePosition is where to resume the bookmark that was saved at the
+// position. It is never before the start of the file.
+func (policy *Policy) ResumePosition(bm *Bookmark, position int64, now time.Time) int64 {
+	if policy == nil || policy.Rewind == nil || !bm.Exists() || position <= 0 {
+		return position
+	}
+	rewind := policy.Rewind
+	if rewind.SkipVideo && bm.Url.Scheme() == "file" && media.IsVideoFile(bm.Url.UnescapedPath()) {
+		return position
+	}
+
+	away := now.Sub(time.Unix(bm.Updated, 0))
+	resumed := position - rewind.rewindAmount(away)
+	if resumed < 0 {
+		resumed = 0
+	}
+
+	if rewind.SnapChapter {
+		if i := bm.ChapterIndex(resumed); i != -1 {
+			resumed = bm.Chapters[i].Position
+		}
+	}
+
+	return resumed
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestResumePosition(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	bm := &Bookmark{
+		Id:      1,
+		Url:     FileUrl("/books/book.m4b"),
+		Updated: now.Add(-time.Minute).Unix(),
+		Chapters: []Chapter{
+			{Position: 0, Title: "One"},
+			{Position: int64(100e+6), Title: "Two"},
+		},
+	}
+	week := 7 * 24 * time.Hour
+	policy := &Policy{Rewind: &RewindPolicy{Min: int64(3e+6), Max: int64(30e+6), MaxAfter: week}}
+
+	require.Equal(t, int64(200e+6), (*Policy)(nil).ResumePosition(bm, int64(200e+6), now),
+		"There should be no rewind without a policy")
+
+	short := policy.ResumePosition(bm, int64(200e+6), now)
+	require.True(t, short < int64(197e+6) && short > int64(190e+6), "A short pause should rewind a few seconds")
+
+	bm.Updated = now.Add(-2 * week).Unix()
+	require.Equal(t, int64(170e+6), policy.ResumePosition(bm, int64(200e+6), now))
+	require.Equal(t, int64(0), policy.ResumePosition(bm, int64(10e+6), now), "The rewind should stop at the start")
+
+	policy.Rewind.SnapChapter = true
+	require.Equal(t, int64(100e+6), policy.ResumePosition(bm, int64(200e+6), now))
+
+	policy.Rewind.SkipVideo = true
+	bm.Url = FileUrl("/movies/movie.mkv")
+	require.Equal(t, int64(200e+6), policy.ResumePosition(bm, int64(200e+6), now))
+}
@@ -0,0 +1,396 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/kballard/go-shellquote"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The search index is an FTS5 table with a row for each bookmark that has the
+// same rowid as the bookmark. SQLite only has FTS5 when it is built with the
+// sqlite_fts5 tag, so without it searching falls back to matching each
+// bookmark in turn.
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// search fields and the columns of the index they match
+var searchFields = map[string]string{
+	"path":   "path",
+	"url":    "path",
+	"title":  "title",
+	"artist": "artist",
+	"album":  "album",
+	"notes":  "notes",
+	"note":   "notes",
+}
+
+// whether the linked SQLite has FTS5, which does not change while playerbm
+// runs
+var fts5Once sync.Once
+var fts5 bool
+
+func fts5Available(db queryer) bool {
+	fts5Once.Do(func() {
+		var used int
+		err := db.QueryRow(`select sqlite_compileoption_used('ENABLE_FTS5');`).Scan(&used)
+		fts5 = err == nil && used == 1
+	})
+	return fts5
+}
+
+// hasSearchIndex checks the database for the search index. InitDb creates the
+// index whenever FTS5 is available, so after that fts5Available tells whether
+// the database has it.
+func hasSearchIndex(db queryer) bool {
+	if !fts5Available(db) {
+		return false
+	}
+	var count int
+	err := db.QueryRow(`
+    select count(*) from sqlite_master where name = 'bookmarks_fts';
+    `).Scan(&count)
+	return err == nil && count > 0
+}
+
+// searchPath is the text of the url that is matched by a search.
+func searchPath(url *XesamUrl) string {
+	if url.Scheme() == "file" {
+		return url.UnescapedPath()
+	}
+	return url.String()
+}
+
+func createSearchIndex(db queryer) error {
+	log.Printf("[DEBUG] creating the search index")
+	_, err := db.Exec(`
+    CREATE VIRTUAL TABLE bookmarks_fts USING fts5(
+        path, title, artist, album, notes,
+        tokenize = 'unicode61 remove_diacritics 2'
+    );
+    `)
+	if err != nil {
+		return err
+	}
+
+	// the columns are the ones the bookmarks table had when the index was
+	// added because later migrations have not run yet
+	rows, err := db.Query(`select id, url, title, artist, album, notes from bookmarks;`)
+	if err != nil {
+		return err
+	}
+	bookmarks := []*Bookmark{}
+	for rows.Next() {
+		bm := &Bookmark{}
+		var url string
+		err = rows.Scan(&bm.Id, &url, &bm.Title, &bm.Artist, &bm.Album, &bm.Notes)
+		if err == nil {
+			bm.Url, err = ParseXesamUrl(url)
+		}
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		bookmarks = append(bookmarks, bm)
+	}
+	rows.Close()
+
+	for _, bm := range bookmarks {
+		err = indexBookmark(bm, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateSearch(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE bookmarks ADD COLUMN title TEXT NOT NULL DEFAULT '';
+    ALTER TABLE bookmarks ADD COLUMN artist TEXT NOT NULL DEFAULT '';
+    ALTER TABLE bookmarks ADD COLUMN album TEXT NOT NULL DEFAULT '';
+    ALTER TABLE bookmarks ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+    `)
+	if err != nil {
+		return err
+	}
+
+	if !fts5Available(tx) {
+		log.Printf("[DEBUG] sqlite was built without FTS5, not creating the search index")
+		return nil
+	}
+
+	return createSearchIndex(tx)
+}
+
+// ensureSearchIndex creates the search index for a database that was
+// migrated by a build without FTS5.
+func ensureSearchIndex(db *sql.DB) error {
+	if !fts5Available(db) || hasSearchIndex(db) {
+		return nil
+	}
+	return createSearchIndex(db)
+}
+
+func indexBookmark(bm *Bookmark, db queryer) error {
+	if !fts5Available(db) {
+		return nil
+	}
+
+	_, err := db.Exec(`delete from bookmarks_fts where rowid = ?;`, bm.Id)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+    insert into bookmarks_fts (rowid, path, title, artist, album, notes)
+    values(?, ?, ?, ?, ?, ?);
+    `, bm.Id, searchPath(bm.Url), bm.Title, bm.Artist, bm.Album, bm.Notes)
+	return err
+}
+
+func unindexBookmark(id int64, db queryer) error {
+	if !fts5Available(db) {
+		return nil
+	}
+	_, err := db.Exec(`delete from bookmarks_fts where rowid = ?;`, id)
+	return err
+}
+
+type searchTerm struct {
+	column string
+	text   string
+}
+
+type searchQuery struct {
+	terms []searchTerm
+	tags  []string
+	// -1 for either, 0 for unfinished and 1 for finished
+	finished int
+}
+
+type SearchError struct {
+	err string
+}
+
+func (e *SearchError) Error() string {
+	return e.err
+}
+
+func parseSearchQuery(query string) (*searchQuery, error) {
+	words, err := shellquote.Split(query)
+	if err != nil {
+		return nil, &SearchError{err: fmt.Sprintf("could not parse query: %s", err.Error())}
+	}
+
+	parsed := searchQuery{finished: -1}
+	for _, word := range words {
+		parts := strings.SplitN(word, ":", 2)
+		if len(parts) == 1 {
+			parsed.terms = append(parsed.terms, searchTerm{text: word})
+			continue
+		}
+
+		field := strings.ToLower(parts[0])
+		value := parts[1]
+
+		if field == "finished" {
+			switch strings.ToLower(value) {
+			case "yes", "true", "1":
+				parsed.finished = 1
+			case "no", "false", "0":
+				parsed.finished = 0
+			default:
+				return nil, &SearchError{err: fmt.Sprintf("finished must be yes or no, got: %s", value)}
+			}
+			continue
+		}
+
+		if field == "tag" {
+			parsed.tags = append(parsed.tags, value)
+			continue
+		}
+
+		column, ok := searchFields[field]
+		if !ok {
+			return nil, &SearchError{err: fmt.Sprintf("unknown search field: %s", field)}
+		}
+		if len(value) > 0 {
+			parsed.terms = append(parsed.terms, searchTerm{column: column, text: value})
+		}
+	}
+
+	return &parsed, nil
+}
+
+// matchExpression is the query in the FTS5 query syntax. Each term is a
+// phrase that matches as a prefix.
+func (query *searchQuery) matchExpression() string {
+	phrases := []string{}
+	for _, term := range query.terms {
+		phrase := `"` + strings.Replace(term.text, `"`, `""`, -1) + `"*`
+		if len(term.column) > 0 {
+			phrase = term.column + " : " + phrase
+		}
+		phrases = append(phrases, phrase)
+	}
+	return strings.Join(phrases, " ")
+}
+
+// relevance of the bookmark to the query when there is no search index. This
+// counts the fields that each term matches.
+func (query *searchQuery) relevance(bm *Bookmark) float64 {
+	fields := map[string]string{
+		"path":   searchPath(bm.Url),
+		"title":  bm.Title,
+		"artist": bm.Artist,
+		"album":  bm.Album,
+		"notes":  bm.Notes,
+	}
+
+	relevance := 0.0
+	for _, term := range query.terms {
+		text := strings.ToLower(term.text)
+		matches := 0
+		for column, value := range fields {
+			if len(term.column) > 0 && term.column != column {
+				continue
+			}
+			if strings.Contains(strings.ToLower(value), text) {
+				matches++
+			}
+		}
+		if matches == 0 {
+			return 0
+		}
+		relevance += float64(matches)
+	}
+
+	if len(query.terms) == 0 {
+		return 1
+	}
+	return relevance
+}
+
+// matchesFilters checks the fields of the query that are not in the search
+// index.
+func (query *searchQuery) matchesFilters(bm *Bookmark) bool {
+	if query.finished != -1 && query.finished != bm.Finished {
+		return false
+	}
+	for _, tag := range query.tags {
+		if !bm.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func getBookmarkById(db *sql.DB, id int64) (*Bookmark, error) {
+	bm, err := scanBookmark(db.QueryRow(`
+    select `+bookmarkColumns+`
+    from bookmarks
+    where id = ?;
+    `, id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadDetails(bm, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return bm, nil
+}
+
+// Search returns the bookmarks that match the query with the best matches
+// first. The query is a list of words that match the path, title, artist,
+// album or notes of the bookmark, or words of the form field:word to only
+// match that field. The finished:yes and finished:no fields filter on whether
+// the bookmark is finished and tag:name only matches bookmarks with the tag.
+func Search(db *sql.DB, query string) ([]Bookmark, error) {
+	parsed, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []Bookmark{}
+	relevance := map[int64]float64{}
+
+	if fts5Available(db) && len(parsed.terms) > 0 {
+		rows, err := db.Query(`
+        select rowid, bm25(bookmarks_fts)
+        from bookmarks_fts
+        where bookmarks_fts match ?;
+        `, parsed.matchExpression())
+		if err != nil {
+			return nil, err
+		}
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			var rank float64
+			err = rows.Scan(&id, &rank)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			// bm25 is more negative for better matches
+			relevance[id] = -rank
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		for _, id := range ids {
+			bm, err := getBookmarkById(db, id)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, *bm)
+		}
+	} else {
+		bookmarks, err := ListBookmarks(db)
+		if err != nil {
+			return nil, err
+		}
+		for _, bm := range bookmarks {
+			if r := parsed.relevance(&bm); r > 0 {
+				relevance[bm.Id] = r
+				candidates = append(candidates, bm)
+			}
+		}
+	}
+
+	results := []Bookmark{}
+	for _, bm := range candidates {
+		if parsed.matchesFilters(&bm) {
+			results = append(results, bm)
+		}
+	}
+
+	// rank by relevance and decay it with the time since the bookmark was
+	// last updated so recent bookmarks come first among similar matches
+	now := time.Now().Unix()
+	score := func(bm *Bookmark) float64 {
+		days := float64(now-bm.Updated) / (24 * 60 * 60)
+		if days < 0 {
+			days = 0
+		}
+		return relevance[bm.Id] / (1 + days/30)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return score(&results[i]) > score(&results[j])
+	})
+
+	return results, nil
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	saveBookmark := func(url string, title string, artist string, finished int) *Bookmark {
+		parsed, err := ParseXesamUrl(url)
+		require.NoError(t, err)
+		bm, err := GetBookmark(db, parsed, nil)
+		require.NoError(t, err)
+		bm.Title = title
+		bm.Artist = artist
+		bm.Finished = finished
+		require.NoError(t, bm.Save(db))
+		return bm
+	}
+
+	war := saveBookmark("http://example.com/books/war-and-peace.mp3", "War and Peace", "Leo Tolstoy", 0)
+	anna := saveBookmark("http://example.com/books/anna-karenina.mp3", "Anna Karenina", "Leo Tolstoy", 1)
+	saveBookmark("http://example.com/podcasts/episode-1.mp3", "The War Room", "Some Podcast", 0)
+
+	anna.Notes = "the train scene"
+	require.NoError(t, anna.Save(db))
+
+	results, err := Search(db, "war")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(results))
+	require.Equal(t, war.Id, results[0].Id,
+		"The bookmark that matches the path and title should rank first")
+
+	results, err = Search(db, "artist:tolstoy")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(results))
+
+	results, err = Search(db, "artist:tolstoy finished:no")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(results))
+	require.Equal(t, war.Id, results[0].Id)
+
+	results, err = Search(db, "train")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(results), "Notes should be searched")
+	require.Equal(t, anna.Id, results[0].Id)
+
+	results, err = Search(db, "'artist:leo tolstoy' karenina")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(results))
+
+	require.NoError(t, anna.Delete(db))
+	results, err = Search(db, "karenina")
+	require.NoError(t, err)
+	require.Equal(t, 0, len(results), "Deleted bookmarks should not be found")
+
+	_, err = Search(db, "colour:blue")
+	require.Error(t, err)
+	_, ok := err.(*SearchError)
+	require.True(t, ok)
+}
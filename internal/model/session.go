@@ -0,0 +1,167 @@
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// A Session is a bookmark for a playlist. It is identified by the urls of the
+// playlist in order and remembers which of them was playing and where.
+type Session struct {
+	Id          int64
+	Urls        []*XesamUrl
+	Current     int
+	Position    int64
+	PlayerCmd   string
+	Created     int64
+	Updated     int64
+	needsCreate bool
+}
+
+const sessionColumns = `id, urls, current, position, player_cmd, created, updated`
+
+func joinUrls(urls []*XesamUrl) string {
+	strs := []string{}
+	for _, url := range urls {
+		strs = append(strs, url.String())
+	}
+	return strings.Join(strs, "\n")
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	session := Session{}
+	var urls string
+	err := row.Scan(&session.Id, &urls, &session.Current, &session.Position,
+		&session.PlayerCmd, &session.Created, &session.Updated)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, url := range strings.Split(urls, "\n") {
+		parsed, err := ParseXesamUrl(url)
+		if err != nil {
+			return nil, err
+		}
+		session.Urls = append(session.Urls, parsed)
+	}
+
+	return &session, nil
+}
+
+// GetSession returns the session for the playlist of urls. The session does
+// not exist yet if the playlist was never saved.
+func GetSession(db *sql.DB, urls []*XesamUrl) (*Session, error) {
+	session, err := scanSession(db.QueryRow(`
+    select `+sessionColumns+`
+    from sessions
+    where urls = ?;
+    `, joinUrls(urls)))
+	if err == sql.ErrNoRows {
+		return &Session{Urls: urls, needsCreate: true}, nil
+	}
+	return session, err
+}
+
+// GetSessionById returns the session with the id or nil if there is none.
+func GetSessionById(db *sql.DB, id int64) (*Session, error) {
+	session, err := scanSession(db.QueryRow(`
+    select `+sessionColumns+`
+    from sessions
+    where id = ?;
+    `, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return session, err
+}
+
+// ListSessions lists the sessions with the most recent first.
+func ListSessions(db *sql.DB) ([]Session, error) {
+	rows, err := db.Query(`
+    select ` + sessionColumns + `
+    from sessions
+    order by updated desc
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (session *Session) Exists() bool {
+	return !session.needsCreate
+}
+
+// Index is the index of the url in the playlist or -1 if it is not in it.
+func (session *Session) Index(url *XesamUrl) int {
+	for i, sessionUrl := range session.Urls {
+		if sessionUrl.String() == url.String() {
+			return i
+		}
+	}
+	return -1
+}
+
+func (session *Session) CurrentUrl() *XesamUrl {
+	if session.Current < 0 || session.Current >= len(session.Urls) {
+		return nil
+	}
+	return session.Urls[session.Current]
+}
+
+func (session *Session) Save(db *sql.DB) error {
+	now := time.Now().Unix()
+
+	if session.needsCreate {
+		result, err := db.Exec(`
+        insert into sessions (urls, current, position, player_cmd, created, updated)
+        values(?, ?, ?, ?, ?, ?);
+        `, joinUrls(session.Urls), session.Current, session.Position, session.PlayerCmd, now, now)
+		if err != nil {
+			return err
+		}
+		session.Id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		session.Created = now
+		session.needsCreate = false
+	} else {
+		_, err := db.Exec(`
+        update sessions
+        set current = ?, position = ?, player_cmd = ?, updated = ?
+        where id = ?;
+        `, session.Current, session.Position, session.PlayerCmd, now, session.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	session.Updated = now
+	return nil
+}
+
+func (session *Session) Delete(db *sql.DB) error {
+	if session.needsCreate {
+		return nil
+	}
+	_, err := db.Exec(`delete from sessions where id = ?;`, session.Id)
+	if err != nil {
+		return err
+	}
+	session.Id = 0
+	session.needsCreate = true
+	return nil
+}
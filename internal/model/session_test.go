@@ -0,0 +1,49 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	urls := []*XesamUrl{}
+	for _, s := range []string{"file:///music/one.mp3", "file:///music/two.mp3", "file:///music/three.mp3"} {
+		url, err := ParseXesamUrl(s)
+		require.NoError(t, err)
+		urls = append(urls, url)
+	}
+
+	session, err := GetSession(db, urls)
+	require.NoError(t, err)
+	require.False(t, session.Exists())
+
+	session.Current = session.Index(urls[1])
+	session.Position = int64(30e+6)
+	session.PlayerCmd = "mpv one.mp3 two.mp3 three.mp3"
+	require.NoError(t, session.Save(db))
+	require.True(t, session.Exists())
+
+	session, err = GetSession(db, urls)
+	require.NoError(t, err)
+	require.True(t, session.Exists(), "The same playlist should get the saved session")
+	require.Equal(t, urls[1].String(), session.CurrentUrl().String())
+	require.Equal(t, int64(30e+6), session.Position)
+
+	reordered, err := GetSession(db, []*XesamUrl{urls[1], urls[0], urls[2]})
+	require.NoError(t, err)
+	require.False(t, reordered.Exists(), "A playlist in another order should be a new session")
+
+	sessions, err := ListSessions(db)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Len(t, sessions[0].Urls, 3)
+
+	require.NoError(t, session.Delete(db))
+	found, err := GetSessionById(db, sessions[0].Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+}
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+)
+
+// The names of the playback settings that are remembered for bookmarks.
+const (
+	SettingRate    = "rate"
+	SettingVolume  = "volume"
+	SettingLoop    = "loop"
+	SettingShuffle = "shuffle"
+)
+
+var SettingNames = []string{SettingRate, SettingVolume, SettingLoop, SettingShuffle}
+
+// A Setting is a playback setting of the player that was in effect for a
+// bookmark. Pinned settings were set by the user and are not changed by the
+// player.
+type Setting struct {
+	Name   string
+	Value  string
+	Pinned bool
+}
+
+type SettingError struct {
+	err string
+}
+
+func (e *SettingError) Error() string {
+	return e.err
+}
+
+// CheckSetting returns an error if the value is not valid for the setting.
+func CheckSetting(name string, value string) error {
+	switch name {
+	case SettingRate, SettingVolume:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 || (name == SettingRate && f == 0) {
+			return &SettingError{err: fmt.Sprintf("%s must be a positive number, got: %s", name, value)}
+		}
+	case SettingLoop:
+		if value != "None" && value != "Track" && value != "Playlist" {
+			return &SettingError{err: fmt.Sprintf("loop must be None, Track or Playlist, got: %s", value)}
+		}
+	case SettingShuffle:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return &SettingError{err: fmt.Sprintf("shuffle must be true or false, got: %s", value)}
+		}
+	default:
+		return &SettingError{err: fmt.Sprintf("unknown setting: %s", name)}
+	}
+	return nil
+}
+
+func loadSettings(bm *Bookmark, db *sql.DB) error {
+	rows, err := db.Query(`
+    select name, value, pinned
+    from settings
+    where bookmark_id = ?
+    order by name
+    `, bm.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	bm.Settings = nil
+	for rows.Next() {
+		setting := Setting{}
+		err = rows.Scan(&setting.Name, &setting.Value, &setting.Pinned)
+		if err != nil {
+			return err
+		}
+		bm.Settings = append(bm.Settings, setting)
+	}
+
+	return rows.Err()
+}
+
+func saveSettings(bm *Bookmark, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`delete from settings where bookmark_id = ?;`, bm.Id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, setting := range bm.Settings {
+		_, err = tx.Exec(`
+        insert into settings (bookmark_id, name, value, pinned)
+        values(?, ?, ?, ?);
+        `, bm.Id, setting.Name, setting.Value, setting.Pinned)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	bm.settingsDirty = false
+	return nil
+}
+
+// Setting returns the setting with the name if the bookmark has it.
+func (bm *Bookmark) Setting(name string) (Setting, bool) {
+	for _, setting := range bm.Settings {
+		if setting.Name == name {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+func (bm *Bookmark) putSetting(setting Setting) {
+	bm.settingsDirty = true
+	for i := range bm.Settings {
+		if bm.Settings[i].Name == setting.Name {
+			bm.Settings[i] = setting
+			return
+		}
+	}
+	bm.Settings = append(bm.Settings, setting)
+}
+
+// RememberSetting records the value the player has for the setting unless
+// the user pinned it. It is saved with the bookmark.
+func (bm *Bookmark) RememberSetting(name string, value string) {
+	if setting, ok := bm.Setting(name); ok && (setting.Pinned || setting.Value == value) {
+		return
+	}
+	bm.putSetting(Setting{Name: name, Value: value})
+}
+
+// PinSetting sets the value of the setting for the bookmark so it is always
+// restored with that value. The bookmark is saved first if it does not exist
+// yet.
+func (bm *Bookmark) PinSetting(db *sql.DB, name string, value string) error {
+	err := CheckSetting(name, value)
+	if err != nil {
+		return err
+	}
+
+	if !bm.Exists() {
+		err := bm.Save(db)
+		if err != nil {
+			return err
+		}
+		if !bm.Exists() {
+			return &PolicyError{err: "the file is too short to bookmark"}
+		}
+	}
+
+	bm.putSetting(Setting{Name: name, Value: value, Pinned: true})
+	return saveSettings(bm, db)
+}
+
+// RemoveSetting forgets the setting for the bookmark whether it was pinned or
+// remembered.
+func (bm *Bookmark) RemoveSetting(db *sql.DB, name string) error {
+	var settings []Setting
+	for _, setting := range bm.Settings {
+		if setting.Name != name {
+			settings = append(settings, setting)
+		}
+	}
+	bm.Settings = settings
+
+	if !bm.Exists() {
+		return nil
+	}
+	return saveSettings(bm, db)
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestSettings(t *testing.T) {
+	f := createTmpFile(t)
+	defer os.Remove(f.Name())
+
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	bm, err := GetBookmark(db, FileUrl(f.Name()), nil)
+	require.NoError(t, err)
+	bm.RememberSetting(SettingRate, "1.6")
+	bm.RememberSetting(SettingShuffle, "false")
+	require.NoError(t, bm.Save(db))
+
+	bm, err = GetBookmark(db, FileUrl(f.Name()), nil)
+	require.NoError(t, err)
+	rate, ok := bm.Setting(SettingRate)
+	require.True(t, ok)
+	require.Equal(t, Setting{Name: SettingRate, Value: "1.6"}, rate)
+
+	require.Error(t, bm.PinSetting(db, SettingVolume, "loud"))
+	require.Error(t, bm.PinSetting(db, "brightness", "1"))
+	require.NoError(t, bm.PinSetting(db, SettingVolume, "0.4"))
+	bm.RememberSetting(SettingVolume, "1")
+	volume, _ := bm.Setting(SettingVolume)
+	require.Equal(t, "0.4", volume.Value, "Pinned settings should not be changed by the player")
+
+	require.NoError(t, bm.RemoveSetting(db, SettingRate))
+	bm, err = GetBookmark(db, FileUrl(f.Name()), nil)
+	require.NoError(t, err)
+	require.Equal(t, []Setting{
+		{Name: SettingShuffle, Value: "false"},
+		{Name: SettingVolume, Value: "0.4", Pinned: true},
+	}, bm.Settings)
+
+	policy := &Policy{NoRestore: []string{SettingVolume}}
+	require.False(t, policy.RestoresSetting(SettingVolume))
+	require.True(t, policy.RestoresSetting(SettingShuffle))
+	require.True(t, (*Policy)(nil).RestoresSetting(SettingVolume))
+}
@@ -0,0 +1,168 @@
+package model
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+)
+
+// A Segment is a part of a file to skip, like an intro or an ad. The positions
+// are in microseconds.
+type Segment struct {
+	Start int64
+	End   int64
+}
+
+func (segment *Segment) Contains(position int64) bool {
+	return position >= segment.Start && position < segment.End
+}
+
+// A DirSegment is a segment that is skipped in the files under a directory
+// that do not have segments of their own.
+type DirSegment struct {
+	Dir string
+	Segment
+}
+
+func scanSegments(rows *sql.Rows) ([]Segment, error) {
+	defer rows.Close()
+
+	var segments []Segment
+	for rows.Next() {
+		segment := Segment{}
+		err := rows.Scan(&segment.Start, &segment.End)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+
+	return segments, rows.Err()
+}
+
+func loadSegments(bm *Bookmark, db *sql.DB) error {
+	rows, err := db.Query(`
+    select start_position, end_position
+    from skip_segments
+    where bookmark_id = ?
+    order by start_position
+    `, bm.Id)
+	if err != nil {
+		return err
+	}
+
+	bm.Segments, err = scanSegments(rows)
+	return err
+}
+
+// AddSegment adds a segment to skip in the file of the bookmark. The bookmark
+// is saved first if it does not exist yet.
+func (bm *Bookmark) AddSegment(db *sql.DB, segment Segment) error {
+	if !bm.Exists() {
+		err := bm.Save(db)
+		if err != nil {
+			return err
+		}
+		if !bm.Exists() {
+			return &PolicyError{err: "the file is too short to bookmark"}
+		}
+	}
+
+	_, err := db.Exec(`
+    insert into skip_segments (bookmark_id, start_position, end_position)
+    values(?, ?, ?);
+    `, bm.Id, segment.Start, segment.End)
+	if err != nil {
+		return err
+	}
+
+	return loadSegments(bm, db)
+}
+
+func (bm *Bookmark) RemoveSegment(db *sql.DB, segment Segment) error {
+	if !bm.Exists() {
+		return nil
+	}
+
+	_, err := db.Exec(`
+    delete from skip_segments
+    where bookmark_id = ? and start_position = ? and end_position = ?;
+    `, bm.Id, segment.Start, segment.End)
+	if err != nil {
+		return err
+	}
+
+	return loadSegments(bm, db)
+}
+
+func ListDirSegments(db *sql.DB) ([]DirSegment, error) {
+	rows, err := db.Query(`
+    select dir, start_position, end_position
+    from skip_segments
+    where bookmark_id = 0
+    order by dir, start_position
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	segments := []DirSegment{}
+	for rows.Next() {
+		segment := DirSegment{}
+		err = rows.Scan(&segment.Dir, &segment.Start, &segment.End)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+
+	return segments, rows.Err()
+}
+
+func AddDirSegment(db *sql.DB, segment DirSegment) error {
+	_, err := db.Exec(`
+    insert into skip_segments (dir, start_position, end_position)
+    values(?, ?, ?);
+    `, segment.Dir, segment.Start, segment.End)
+	return err
+}
+
+func RemoveDirSegment(db *sql.DB, segment DirSegment) error {
+	_, err := db.Exec(`
+    delete from skip_segments
+    where bookmark_id = 0 and dir = ? and start_position = ? and end_position = ?;
+    `, segment.Dir, segment.Start, segment.End)
+	return err
+}
+
+// SkipSegments are the segments to skip in the file of the bookmark. These
+// are the segments of the bookmark or else the defaults of the closest
+// directory above the file that has any.
+func (bm *Bookmark) SkipSegments(db *sql.DB) ([]Segment, error) {
+	if len(bm.Segments) > 0 || bm.Url.Scheme() != "file" {
+		return bm.Segments, nil
+	}
+
+	dirSegments, err := ListDirSegments(db)
+	if err != nil {
+		return nil, err
+	}
+
+	path := bm.Url.UnescapedPath()
+	closest := ""
+	segments := []Segment{}
+	for _, dirSegment := range dirSegments {
+		dir := strings.TrimSuffix(dirSegment.Dir, "/")
+		if !strings.HasPrefix(filepath.Dir(path)+"/", dir+"/") || len(dir) < len(closest) {
+			continue
+		}
+		if len(dir) > len(closest) {
+			closest = dir
+			segments = []Segment{}
+		}
+		segments = append(segments, dirSegment.Segment)
+	}
+
+	return segments, nil
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSkipSegments(t *testing.T) {
+	f := createTmpFile(t)
+	defer os.Remove(f.Name())
+
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	intro := Segment{Start: 0, End: int64(45e+6)}
+	require.NoError(t, AddDirSegment(db, DirSegment{Dir: "/", Segment: Segment{Start: 0, End: int64(10e+6)}}))
+	require.NoError(t, AddDirSegment(db, DirSegment{Dir: filepath.Dir(f.Name()), Segment: intro}))
+
+	bm, err := GetBookmark(db, FileUrl(f.Name()), nil)
+	require.NoError(t, err)
+	segments, err := bm.SkipSegments(db)
+	require.NoError(t, err)
+	require.Equal(t, []Segment{intro}, segments,
+		"The defaults of the closest directory should be used")
+
+	ad := Segment{Start: int64(600e+6), End: int64(660e+6)}
+	require.NoError(t, bm.AddSegment(db, ad))
+	require.True(t, bm.Exists(), "Adding a segment should save the bookmark")
+
+	bm, err = GetBookmark(db, FileUrl(f.Name()), nil)
+	require.NoError(t, err)
+	segments, err = bm.SkipSegments(db)
+	require.NoError(t, err)
+	require.Equal(t, []Segment{ad}, segments,
+		"The segments of the file should replace the directory defaults")
+	require.True(t, ad.Contains(int64(600e+6)))
+	require.False(t, ad.Contains(int64(660e+6)))
+
+	require.NoError(t, bm.RemoveSegment(db, ad))
+	require.Empty(t, bm.Segments)
+}
@@ -0,0 +1,229 @@
+package model
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+type Tag struct {
+	Name  string
+	Count int
+}
+
+// A TagRule tags new bookmarks for files under a path prefix.
+type TagRule struct {
+	Tag    string
+	Prefix string
+}
+
+func (rule *TagRule) Matches(url *XesamUrl) bool {
+	if url.Scheme() != "file" {
+		return false
+	}
+	path := url.UnescapedPath()
+	prefix := strings.TrimSuffix(rule.Prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// Tag names are compared without case everywhere. The queries get that from
+// the NOCASE collation of tags.name and HasTag compares the loaded names the
+// same way, so a tag keeps the case it was first added with.
+func getTagId(db queryer, name string, create bool) (int64, error) {
+	var id int64
+	err := db.QueryRow(`select id from tags where name = ?;`, name).Scan(&id)
+	if err == sql.ErrNoRows && create {
+		result, err := db.Exec(`insert into tags (name) values(?);`, name)
+		if err != nil {
+			return 0, err
+		}
+		return result.LastInsertId()
+	}
+	return id, err
+}
+
+func loadTags(bm *Bookmark, db *sql.DB) error {
+	rows, err := db.Query(`
+    select tags.name
+    from tags join bookmark_tags on tags.id = bookmark_tags.tag_id
+    where bookmark_tags.bookmark_id = ?
+    order by tags.name
+    `, bm.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	bm.Tags = nil
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return err
+		}
+		bm.Tags = append(bm.Tags, name)
+	}
+
+	return rows.Err()
+}
+
+// HasTag is whether the bookmark has the tag, compared without case like the
+// names in the tags table.
+func (bm *Bookmark) HasTag(name string) bool {
+	for _, tag := range bm.Tags {
+		if strings.EqualFold(tag, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTag adds the bookmark to the collection with the given name. The
+// bookmark is saved first if it does not exist yet.
+func (bm *Bookmark) AddTag(db *sql.DB, name string) error {
+	if bm.HasTag(name) {
+		return nil
+	}
+
+	if !bm.Exists() {
+		err := bm.Save(db)
+		if err != nil {
+			return err
+		}
+		if !bm.Exists() {
+			return &PolicyError{err: "the file is too short to bookmark"}
+		}
+	}
+
+	tagId, err := getTagId(db, name, true)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+    insert or ignore into bookmark_tags (bookmark_id, tag_id)
+    values(?, ?);
+    `, bm.Id, tagId)
+	if err != nil {
+		return err
+	}
+
+	return loadTags(bm, db)
+}
+
+func (bm *Bookmark) RemoveTag(db *sql.DB, name string) error {
+	if !bm.Exists() {
+		return nil
+	}
+
+	_, err := db.Exec(`
+    delete from bookmark_tags
+    where bookmark_id = ? and tag_id in (select id from tags where name = ?);
+    `, bm.Id, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+    delete from tags
+    where id not in (select tag_id from bookmark_tags)
+        and id not in (select tag_id from tag_rules);
+    `)
+	if err != nil {
+		return err
+	}
+
+	return loadTags(bm, db)
+}
+
+// ListTags returns all the tags with the number of bookmarks that have them.
+func ListTags(db *sql.DB) ([]Tag, error) {
+	rows, err := db.Query(`
+    select tags.name, count(bookmark_tags.bookmark_id)
+    from tags left join bookmark_tags on tags.id = bookmark_tags.tag_id
+    group by tags.id
+    order by tags.name
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		tag := Tag{}
+		err = rows.Scan(&tag.Name, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func ListTagRules(db *sql.DB) ([]TagRule, error) {
+	rows, err := db.Query(`
+    select tags.name, tag_rules.prefix
+    from tag_rules join tags on tags.id = tag_rules.tag_id
+    order by tag_rules.prefix
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []TagRule{}
+	for rows.Next() {
+		rule := TagRule{}
+		err = rows.Scan(&rule.Tag, &rule.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func AddTagRule(db *sql.DB, rule TagRule) error {
+	tagId, err := getTagId(db, rule.Tag, true)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+    insert or ignore into tag_rules (tag_id, prefix)
+    values(?, ?);
+    `, tagId, rule.Prefix)
+	return err
+}
+
+func RemoveTagRule(db *sql.DB, rule TagRule) error {
+	_, err := db.Exec(`
+    delete from tag_rules
+    where prefix = ? and tag_id in (select id from tags where name = ?);
+    `, rule.Prefix, rule.Tag)
+	return err
+}
+
+// applyTagRules tags a new bookmark with the tags of the rules that match its
+// path.
+func applyTagRules(bm *Bookmark, db *sql.DB) error {
+	rules, err := ListTagRules(db)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if rule.Matches(bm.Url) {
+			log.Printf("[DEBUG] tagging bookmark with '%s' by rule for %s", rule.Tag, rule.Prefix)
+			err = bm.AddTag(db, rule.Tag)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
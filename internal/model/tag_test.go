@@ -0,0 +1,116 @@
+package model
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	url, err := ParseXesamUrl("http://example.com/lecture-1.mp4")
+	require.NoError(t, err)
+	bm, err := GetBookmark(db, url, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, bm.AddTag(db, "course: linear algebra"))
+	require.True(t, bm.Exists(), "Tagging a bookmark should save it")
+	require.NoError(t, bm.AddTag(db, "Commute"))
+	require.Equal(t, []string{"Commute", "course: linear algebra"}, bm.Tags)
+
+	bm, err = GetBookmark(db, url, nil)
+	require.NoError(t, err)
+	require.True(t, bm.HasTag("commute"), "Tags should be loaded with the bookmark")
+
+	other, err := ParseXesamUrl("http://example.com/other.mp4")
+	require.NoError(t, err)
+	otherBm, err := GetBookmark(db, other, nil)
+	require.NoError(t, err)
+	require.NoError(t, otherBm.Save(db))
+
+	bookmarks, err := ListTaggedBookmarks(db, "commute")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(bookmarks))
+	require.Equal(t, bm.Id, bookmarks[0].Id)
+
+	recent, err := GetMostRecentTaggedBookmark(db, "commute")
+	require.NoError(t, err)
+	require.Equal(t, bm.Id, recent.Id)
+
+	results, err := Search(db, "tag:commute")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(results))
+
+	require.NoError(t, bm.RemoveTag(db, "commute"))
+	require.Equal(t, []string{"course: linear algebra"}, bm.Tags)
+	tags, err := ListTags(db)
+	require.NoError(t, err)
+	require.Equal(t, []Tag{{Name: "course: linear algebra", Count: 1}}, tags,
+		"Tags without bookmarks should be removed")
+}
+
+func TestTagRules(t *testing.T) {
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	f := createTmpFile(t)
+	defer os.Remove(f.Name())
+
+	require.NoError(t, AddTagRule(db, TagRule{Tag: "kids", Prefix: filepath.Dir(f.Name())}))
+	require.NoError(t, AddTagRule(db, TagRule{Tag: "unrelated", Prefix: f.Name() + "-other"}))
+
+	url, err := ParseXesamUrl("file://" + f.Name())
+	require.NoError(t, err)
+	bm, err := GetBookmark(db, url, nil)
+	require.NoError(t, err)
+	require.NoError(t, bm.Save(db))
+	require.Equal(t, []string{"kids"}, bm.Tags,
+		"New bookmarks should be tagged by the rules that match their path")
+
+	rules, err := ListTagRules(db)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(rules))
+	require.NoError(t, RemoveTagRule(db, rules[0]))
+	rules, err = ListTagRules(db)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(rules))
+}
+
+func TestTagNamesIgnoreCase(t *testing.T) {
+	db, err := InitDb(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	first, err := ParseXesamUrl("http://example.com/first.mp4")
+	require.NoError(t, err)
+	firstBm, err := GetBookmark(db, first, nil)
+	require.NoError(t, err)
+	second, err := ParseXesamUrl("http://example.com/second.mp4")
+	require.NoError(t, err)
+	secondBm, err := GetBookmark(db, second, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, firstBm.AddTag(db, "Foo"))
+	require.NoError(t, secondBm.AddTag(db, "foo"))
+	tags, err := ListTags(db)
+	require.NoError(t, err)
+	require.Equal(t, []Tag{{Name: "Foo", Count: 2}}, tags, "Names that only differ in case should be one tag")
+
+	results, err := Search(db, "tag:FOO")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(results))
+
+	require.NoError(t, secondBm.RemoveTag(db, "FOO"))
+	require.Empty(t, secondBm.Tags)
+
+	require.NoError(t, AddTagRule(db, TagRule{Tag: "Lectures", Prefix: "/lectures"}))
+	require.NoError(t, RemoveTagRule(db, TagRule{Tag: "lectures", Prefix: "/lectures"}))
+	rules, err := ListTagRules(db)
+	require.NoError(t, err)
+	require.Empty(t, rules)
+}
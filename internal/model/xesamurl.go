@@ -60,3 +60,8 @@ func (xesamUrl *XesamUrl) ShellQuoted() string {
 	}
 	return shellquote.Join(unescaped)
 }
+
+// FileUrl is the file url for an absolute path in the form players report it.
+func FileUrl(path string) *XesamUrl {
+	return &XesamUrl{base: &urllib.URL{Scheme: "file", Path: path}}
+}
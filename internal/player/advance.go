@@ -0,0 +1,153 @@
+package player
+
+import (
+	"github.com/altdesktop/playerbm/internal/model"
+	"github.com/godbus/dbus/v5"
+	"github.com/kballard/go-shellquote"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// nextUrl is what to play after the url finishes. That is the head of the
+// queue if the url was queued or else the next file in its directory.
+func (player *Player) nextUrl(url *model.XesamUrl) (*model.XesamUrl, error) {
+	if player.queued {
+		// the finished url is already removed from the queue
+		return model.QueueHead(player.DB)
+	}
+	return model.NextFile(url)
+}
+
+// advance finishes the current bookmark and opens what comes next in the
+// running player. The bookmark of the next url is restored when the player
+// changes the url. If the player cannot open it, it is opened by running the
+// player command again when the player exits.
+func (player *Player) advance() {
+	player.stopListening()
+	player.rememberSettings()
+	bookmark := player.Bookmark
+	bookmark.Position = bookmark.Length
+	err := bookmark.Save(player.DB)
+	if err != nil {
+		log.Printf("[DEBUG] could not save finished bookmark: %+v", err)
+		return
+	}
+
+	// players often reset the position when they stop so the finished
+	// bookmark must not be updated again
+	player.Bookmark = nil
+	player.finishedUrl = bookmark.Url
+
+	next, err := player.nextUrl(bookmark.Url)
+	if err != nil {
+		log.Printf("[DEBUG] could not find the next url: %+v", err)
+		return
+	}
+	if next == nil {
+		log.Printf("[DEBUG] nothing to play next")
+		return
+	}
+
+	log.Printf("[DEBUG] advancing to the next url: %s", next)
+	err = player.MprisObj.Call("org.mpris.MediaPlayer2.Player.OpenUri", dbus.FlagNoAutoStart, next.String()).Store()
+	if err != nil {
+		log.Printf("[DEBUG] could not open the next url: %+v", err)
+		return
+	}
+	player.finishedUrl = nil
+}
+
+// commandArg is the url as it is passed to a player command.
+func commandArg(url *model.XesamUrl) string {
+	if url.Scheme() == "file" {
+		return url.UnescapedPath()
+	}
+	return url.String()
+}
+
+// urlArgIndex is the index of the word of a command that opens the url or -1
+// if there is none.
+func urlArgIndex(words []string, url *model.XesamUrl) int {
+	for i, word := range words {
+		if word == url.String() {
+			return i
+		}
+		if url.Scheme() == "file" {
+			if abs, err := filepath.Abs(word); err == nil && abs == url.UnescapedPath() {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// nextPlayerCmd is the player command with the argument for the url replaced
+// with the next url. It returns false if the command does not open the url.
+func nextPlayerCmd(playerCmd string, url *model.XesamUrl, next *model.XesamUrl) (string, bool) {
+	words, err := shellquote.Split(playerCmd)
+	if err != nil {
+		return "", false
+	}
+
+	i := urlArgIndex(words, url)
+	if i == -1 {
+		return "", false
+	}
+	words[i] = commandArg(next)
+	return shellquote.Join(words...), true
+}
+
+// relaunch sets up the player to run the command again for what comes after
+// the finished bookmark when the player exited at the end of the file.
+func (player *Player) relaunch() bool {
+	if !player.Cli.AutoAdvanceFlag || player.ExitCode != 0 {
+		return false
+	}
+
+	finishedUrl := player.finishedUrl
+	if finishedUrl == nil && player.Bookmark != nil && player.Bookmark.Finished == 1 {
+		finishedUrl = player.Bookmark.Url
+	}
+	if finishedUrl == nil {
+		return false
+	}
+
+	next, err := player.nextUrl(finishedUrl)
+	if err != nil || next == nil {
+		log.Printf("[DEBUG] nothing to play next: %+v", err)
+		return false
+	}
+
+	playerCmd, ok := nextPlayerCmd(player.Cli.PlayerCmd, finishedUrl, next)
+	if !ok {
+		log.Printf("[DEBUG] the player command does not open the finished url, not relaunching")
+		return false
+	}
+
+	log.Printf("[DEBUG] relaunching the player for the next url: %s", next)
+	player.Cli.PlayerCmd = playerCmd
+	player.Cli.ResumeUrl = next
+	player.Cmd = nil
+	player.Bookmark = nil
+	player.finishedUrl = nil
+	player.queued = false
+	player.Session = nil
+	player.restoreSession = false
+	player.setBusName("")
+	player.setNameOwner("")
+	player.MprisObj = nil
+	player.TrackId = ""
+	player.Status = Stopped
+	player.Rate = 1
+	player.settings = map[string]string{}
+	player.polling = false
+	player.seekedDeadline = time.Time{}
+	player.restore = nil
+	player.CanSeek = true
+	player.Length = 0
+	player.detached = false
+	player.processErr = nil
+	player.ProcessFinish = make(chan error)
+	return true
+}
@@ -0,0 +1,42 @@
+package player
+
+import (
+	"errors"
+)
+
+// Going to the previous chapter within this many microseconds of the start of
+// a chapter goes to the chapter before it instead of the start of the current
+// one.
+const chapterRestartThreshold = int64(3e+6)
+
+// SeekChapter moves the player delta chapters from the current chapter and
+// returns the index of the chapter it moved to.
+func (player *Player) SeekChapter(delta int) (int, error) {
+	if player.Bookmark == nil || len(player.Bookmark.Chapters) == 0 {
+		return -1, errors.New("the current track does not have chapters")
+	}
+
+	chapters := player.Bookmark.Chapters
+	position := player.currentPosition()
+	current := player.Bookmark.ChapterIndex(position)
+
+	if delta < 0 && current >= 0 && position-chapters[current].Position > chapterRestartThreshold {
+		// the first step back goes to the start of the current chapter
+		delta++
+	}
+
+	target := current + delta
+	if target < 0 {
+		target = 0
+	}
+	if target >= len(chapters) {
+		return -1, errors.New("already at the last chapter")
+	}
+
+	err := player.syncPosition(chapters[target].Position)
+	if err != nil {
+		return -1, err
+	}
+
+	return target, nil
+}
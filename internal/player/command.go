@@ -0,0 +1,135 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"github.com/altdesktop/playerbm/internal/media"
+	"github.com/altdesktop/playerbm/internal/model"
+	"github.com/kballard/go-shellquote"
+	"log"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// urlPlaceholder stands for the url in the player command saved with a
+// bookmark.
+const urlPlaceholder = "{}"
+
+// PlayerCmdTemplate is the player command with the argument that opens the url
+// replaced with a placeholder. It is empty if the command does not open the
+// url.
+func PlayerCmdTemplate(playerCmd string, url *model.XesamUrl) string {
+	words, err := shellquote.Split(playerCmd)
+	if err != nil {
+		return ""
+	}
+
+	i := urlArgIndex(words, url)
+	if i == -1 {
+		return ""
+	}
+	quoted := make([]string, len(words))
+	for j, word := range words {
+		quoted[j] = shellquote.Join(word)
+	}
+	quoted[i] = urlPlaceholder
+	return strings.Join(quoted, " ")
+}
+
+// CommandProgram is the name of the program a player command runs, like mpv
+// for "/usr/bin/mpv --no-video {}". It is empty for an empty command.
+func CommandProgram(playerCmd string) string {
+	words, err := shellquote.Split(playerCmd)
+	if err != nil || len(words) == 0 {
+		return ""
+	}
+	return filepath.Base(words[0])
+}
+
+// FillPlayerCmd is the command to open the url with a player command template.
+// The url is added to the end if the template does not have a placeholder.
+func FillPlayerCmd(template string, url *model.XesamUrl) (string, error) {
+	words, err := shellquote.Split(template)
+	if err != nil {
+		return "", err
+	}
+
+	filled := false
+	for i, word := range words {
+		if word == urlPlaceholder {
+			words[i] = commandArg(url)
+			filled = true
+		}
+	}
+	if !filled {
+		words = append(words, commandArg(url))
+	}
+	return shellquote.Join(words...), nil
+}
+
+// rememberPlayerCmd saves the command that opened the bookmark so it can be
+// resumed with the same player and options.
+func (player *Player) rememberPlayerCmd(bookmark *model.Bookmark) {
+	if player.Cmd == nil || player.Cli.ResumeFlag {
+		return
+	}
+	if template := PlayerCmdTemplate(player.Cli.PlayerCmd, bookmark.Url); len(template) > 0 {
+		bookmark.PlayerCmd = template
+	}
+}
+
+// DefaultPlayers are the player commands to resume urls with by the url
+// scheme, the file extension (".m4b") or the MIME type ("video/mp4" or
+// "audio/*"). The "default" command is for everything else.
+type DefaultPlayers map[string]string
+
+// CheckDefaultPlayerKey returns an error if the key does not name a scheme,
+// extension or MIME type.
+func CheckDefaultPlayerKey(key string) error {
+	if key == "default" || strings.HasPrefix(key, ".") {
+		return nil
+	}
+	if parts := strings.Split(key, "/"); len(parts) == 2 {
+		if len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return errors.New(fmt.Sprintf("not a MIME type: %s", key))
+		}
+		return nil
+	}
+	for _, c := range key {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("+-.", c) {
+			return errors.New(fmt.Sprintf("expected a url scheme, extension or MIME type, got: %s", key))
+		}
+	}
+	return nil
+}
+
+// Cmd is the player command template for the url. The MIME type of a local
+// file is detected from its content.
+func (players DefaultPlayers) Cmd(url *model.XesamUrl) (string, bool) {
+	if url.Scheme() != "file" {
+		if cmd, ok := players[url.Scheme()]; ok {
+			return cmd, true
+		}
+		cmd, ok := players["default"]
+		return cmd, ok
+	}
+
+	path := url.UnescapedPath()
+	if cmd, ok := players[strings.ToLower(filepath.Ext(path))]; ok {
+		return cmd, true
+	}
+
+	if mimeType := media.DetectMimeType(path); len(mimeType) > 0 {
+		log.Printf("[DEBUG] detected the MIME type %s for %s", mimeType, path)
+		if cmd, ok := players[mimeType]; ok {
+			return cmd, true
+		}
+		if cmd, ok := players[strings.Split(mimeType, "/")[0]+"/*"]; ok {
+			return cmd, true
+		}
+	}
+
+	cmd, ok := players["default"]
+	return cmd, ok
+}
@@ -0,0 +1,31 @@
+package player
+
+import (
+	"github.com/altdesktop/playerbm/internal/model"
+	"log"
+)
+
+// startListening starts a span of playback at the current position if the
+// player is playing.
+func (player *Player) startListening() {
+	player.listening = player.Status == Playing && player.Bookmark != nil && !player.restoring()
+	if player.listening {
+		player.listenStart = player.currentPosition()
+	}
+}
+
+// stopListening records the span of playback since it started on the
+// bookmark. It must be called before the position or status changes.
+func (player *Player) stopListening() {
+	if !player.listening {
+		return
+	}
+	player.listening = false
+	if player.Bookmark == nil {
+		return
+	}
+
+	segment := model.Segment{Start: player.listenStart, End: player.currentPosition()}
+	log.Printf("[DEBUG] listened from %s to %s", FormatPosition(segment.Start), FormatPosition(segment.End))
+	player.Bookmark.AddListened(segment)
+}
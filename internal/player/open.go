@@ -0,0 +1,106 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"github.com/altdesktop/playerbm/internal/media"
+	"github.com/altdesktop/playerbm/internal/model"
+	"github.com/godbus/dbus/v5"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// how long to wait for a running player to open a url
+	openTimeout = 5 * time.Second
+	// how often to check whether the running player opened the url
+	openCheckInterval = 100 * time.Millisecond
+)
+
+// MatchPlayerName finds the running player with the name. Players with more
+// than one instance have names like "vlc.instance1234" and match "vlc".
+func MatchPlayerName(names []string, name string) (string, bool) {
+	name = strings.TrimPrefix(name, mprisPrefix)
+	for _, running := range names {
+		if running == name {
+			return running, true
+		}
+	}
+	for _, running := range names {
+		if strings.HasPrefix(running, name+".") {
+			return running, true
+		}
+	}
+	return "", false
+}
+
+// Supports is whether the player says it can open the url by its scheme and
+// the MIME type of a local file.
+func (player *Player) Supports(url *model.XesamUrl) (bool, error) {
+	var propertiesVariant map[string]dbus.Variant
+	err := player.MprisObj.Call("org.freedesktop.DBus.Properties.GetAll", dbus.FlagNoAutoStart, "org.mpris.MediaPlayer2").Store(&propertiesVariant)
+	if err != nil {
+		return false, err
+	}
+
+	var schemes []string
+	if variant, ok := propertiesVariant["SupportedUriSchemes"]; ok {
+		schemes, _ = variant.Value().([]string)
+	}
+	if !containsFold(schemes, url.Scheme()) {
+		return false, nil
+	}
+
+	if url.Scheme() != "file" {
+		return true, nil
+	}
+
+	var mimeTypes []string
+	if variant, ok := propertiesVariant["SupportedMimeTypes"]; ok {
+		mimeTypes, _ = variant.Value().([]string)
+	}
+	mimeType := media.DetectMimeType(url.UnescapedPath())
+	return len(mimeType) > 0 && containsFold(mimeTypes, mimeType), nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenUri opens the url in the running player and loads its bookmark. The
+// bookmark of what the player was playing before is saved when it changes
+// track.
+func (player *Player) OpenUri(url *model.XesamUrl) error {
+	err := player.EnsureBookmark()
+	if err != nil {
+		log.Printf("[DEBUG] the player has no bookmark before opening the url: %+v", err)
+		player.Bookmark = nil
+	}
+
+	log.Printf("[DEBUG] opening %s in %s", url, player.BusName)
+	err = player.MprisObj.Call("org.mpris.MediaPlayer2.Player.OpenUri", dbus.FlagNoAutoStart, url.String()).Store()
+	if err != nil {
+		return err
+	}
+
+	deadline := player.now().Add(openTimeout)
+	for player.now().Before(deadline) {
+		properties, err := player.GetPropertiesRemote()
+		if err != nil {
+			return err
+		}
+		if properties.Url != nil && properties.Url.String() == url.String() {
+			player.syncBookmark(properties)
+			return nil
+		}
+		time.Sleep(openCheckInterval)
+	}
+
+	return errors.New(fmt.Sprintf("the player did not open the url after %s", openTimeout))
+}
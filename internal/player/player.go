@@ -8,9 +8,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 )
 
@@ -56,6 +54,23 @@ func parseProperties(propertiesVariant map[string]dbus.Variant) *Properties {
 					}
 				}
 			}
+
+			// get the tags
+			if variant, found := metadata["xesam:title"]; found {
+				if val, ok := variant.Value().(string); ok {
+					properties.Title = val
+				}
+			}
+			if variant, found := metadata["xesam:artist"]; found {
+				if val, ok := variant.Value().([]string); ok {
+					properties.Artist = strings.Join(val, ", ")
+				}
+			}
+			if variant, found := metadata["xesam:album"]; found {
+				if val, ok := variant.Value().(string); ok {
+					properties.Album = val
+				}
+			}
 		}
 	}
 
@@ -66,12 +81,33 @@ func parseProperties(propertiesVariant map[string]dbus.Variant) *Properties {
 		}
 	}
 
+	// get the playback rate
+	if variant, found := propertiesVariant["Rate"]; found {
+		if val, ok := variant.Value().(float64); ok && val > 0 {
+			properties.Rate = val
+			properties.HasRate = true
+		}
+	}
+
+	if variant, found := propertiesVariant["CanSeek"]; found {
+		if val, ok := variant.Value().(bool); ok {
+			properties.CanSeek = val
+			properties.HasCanSeek = true
+		}
+	}
+
+	properties.Settings = parseSettings(propertiesVariant)
+
 	return &properties
 }
 
 func (player *Player) GetPropertiesRemote() (*Properties, error) {
+	return getProperties(player.MprisObj)
+}
+
+func getProperties(obj dbus.BusObject) (*Properties, error) {
 	var propertiesVariant map[string]dbus.Variant
-	err := player.MprisObj.Call("org.freedesktop.DBus.Properties.GetAll", dbus.FlagNoAutoStart, "org.mpris.MediaPlayer2.Player").Store(&propertiesVariant)
+	err := obj.Call("org.freedesktop.DBus.Properties.GetAll", dbus.FlagNoAutoStart, "org.mpris.MediaPlayer2.Player").Store(&propertiesVariant)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +121,13 @@ func (player *Player) SetPlayerProperties(properties *Properties) {
 	if properties.HasLength {
 		player.Length = properties.Length
 	}
+	if properties.HasRate {
+		player.Rate = properties.Rate
+	}
+	if properties.HasCanSeek {
+		player.CanSeek = properties.CanSeek
+	}
+	player.syncSettings(properties)
 	if properties.HasPosition {
 		player.setPosition(properties.Position)
 	}
@@ -92,11 +135,16 @@ func (player *Player) SetPlayerProperties(properties *Properties) {
 
 func (player *Player) syncBookmark(properties *Properties) {
 	var queueUpdate bool
+	var urlChanged bool
 
 	if len(properties.TrackId) > 0 {
 		player.TrackId = properties.TrackId
 	}
 
+	if properties.HasCanSeek {
+		player.CanSeek = properties.CanSeek
+	}
+
 	currentUrl := player.currentUrl()
 	if properties.Url != nil && (currentUrl == nil || properties.Url.String() != currentUrl.String()) {
 		log.Printf("[DEBUG] url has changed from '%s' to '%s'", currentUrl, properties.Url)
@@ -104,13 +152,28 @@ func (player *Player) syncBookmark(properties *Properties) {
 		if err != nil {
 			log.Printf("[DEBUG] could not update current bookmark: %+v", err)
 		}
+		// the length is not known until the player gives it for the new url
+		player.Length = 0
+		if properties.HasLength {
+			player.Length = properties.Length
+		}
+		if properties.HasPosition {
+			player.setPosition(properties.Position)
+		}
 		err = player.LoadBookmark(properties.Url)
 		if err != nil {
 			log.Printf("[DEBUG] could not load bookmark: %+v", err)
 		}
 		queueUpdate = true
+		urlChanged = true
 	}
 
+	player.syncTags(properties)
+	player.syncSettings(properties)
+
+	if properties.HasLength {
+		player.Length = properties.Length
+	}
 	if properties.HasLength && player.Bookmark != nil && player.Bookmark.Length != properties.Length {
 		log.Printf("[DEBUG] setting player length to '%s'", FormatPosition(properties.Length))
 		player.Bookmark.Length = properties.Length
@@ -118,9 +181,14 @@ func (player *Player) syncBookmark(properties *Properties) {
 
 	if len(properties.Status) > 0 && properties.Status != player.Status {
 		log.Printf("[DEBUG] playback status has changed from '%s' to '%s'", player.Status, properties.Status)
+		player.stopListening()
+		if properties.Status != Playing && player.Cli.AutoAdvanceFlag &&
+			player.Bookmark != nil && player.Bookmark.IsAtEnd(player.currentPosition()) {
+			player.advance()
+		}
 		switch properties.Status {
 		case Playing:
-			player.PositionTime = time.Now()
+			player.PositionTime = player.now()
 		case Paused:
 		case Stopped:
 			// TODO: no track currently playing if stopped
@@ -130,12 +198,25 @@ func (player *Player) syncBookmark(properties *Properties) {
 		}
 		queueUpdate = true
 		player.Status = properties.Status
+		player.startListening()
 	}
 
-	if properties.HasPosition {
+	if properties.HasRate && properties.Rate != player.Rate {
+		log.Printf("[DEBUG] rate has changed from %g to %g", player.Rate, properties.Rate)
+		player.setRate(properties.Rate)
+	}
+
+	// the position that came with a new url is from before it was restored
+	if properties.HasPosition && !(urlChanged && player.restoring()) {
 		log.Printf("[DEBUG] position has changed from '%s' to '%s'", FormatPosition(player.currentPosition()), FormatPosition(properties.Position))
+		if player.restoring() {
+			player.confirmRestore(properties.Position)
+		}
+		player.stopListening()
 		player.setPosition(properties.Position)
+		player.startListening()
 	}
+	player.stepRestore()
 
 	player.logPosition()
 	player.logCurrentBookmark()
@@ -143,15 +224,45 @@ func (player *Player) syncBookmark(properties *Properties) {
 	if queueUpdate {
 		// Run this if anything important has changed. This works around spec
 		// weirdness regarding position.
-		go func() {
-			properties, err := player.GetPropertiesRemote()
-			if err != nil {
-				log.Printf("[DEBUG] could not get properties: %+v", err)
-				return
-			}
+		player.refresh()
+	}
+}
+
+// refresh gets the properties from the player in the background. They are
+// sent to the goroutine of the player, which syncs the bookmark with them
+// while it is managed.
+func (player *Player) refresh() {
+	obj := player.MprisObj
+	updates := player.updates
+	go func() {
+		properties, err := getProperties(obj)
+		if err != nil {
+			log.Printf("[DEBUG] could not get properties: %+v", err)
+			return
+		}
 
-			player.syncBookmark(properties)
-		}()
+		select {
+		case updates <- properties:
+		default:
+			log.Printf("[DEBUG] too many property updates are waiting, dropping one")
+		}
+	}()
+}
+
+// syncTags copies the tags the player gives for the track to the bookmark so
+// they can be searched.
+func (player *Player) syncTags(properties *Properties) {
+	if player.Bookmark == nil {
+		return
+	}
+	if len(properties.Title) > 0 {
+		player.Bookmark.Title = properties.Title
+	}
+	if len(properties.Artist) > 0 {
+		player.Bookmark.Artist = properties.Artist
+	}
+	if len(properties.Album) > 0 {
+		player.Bookmark.Album = properties.Album
 	}
 }
 
@@ -163,9 +274,12 @@ func (player *Player) currentUrl() *model.XesamUrl {
 	return player.Bookmark.Url
 }
 
+// currentPosition extrapolates the position from when the player last gave
+// it with the playback rate.
 func (player *Player) currentPosition() int64 {
 	if player.Status == Playing {
-		return player.Position + time.Since(player.PositionTime).Microseconds()
+		elapsed := player.now().Sub(player.PositionTime).Microseconds()
+		return player.Position + int64(float64(elapsed)*player.Rate)
 	} else {
 		return player.Position
 	}
@@ -185,35 +299,52 @@ func (player *Player) logCurrentBookmark() {
 
 func (player *Player) setPosition(ms int64) {
 	player.Position = ms
-	player.PositionTime = time.Now()
+	player.PositionTime = player.now()
 }
 
-func (player *Player) syncPosition(ms int64) error {
-	if len(player.TrackId) == 0 {
-		return errors.New("Player does not have a trackid")
-	}
-
-	if !player.TrackId.IsValid() {
-		return errors.New(fmt.Sprintf("Player has an invalid trackid: '%s'", player.TrackId))
-	}
+// setRate changes the playback rate from the current position so the time
+// played at the old rate is kept.
+func (player *Player) setRate(rate float64) {
+	player.setPosition(player.currentPosition())
+	player.Rate = rate
+}
 
+func (player *Player) syncPosition(ms int64) error {
 	log.Printf("[DEBUG] Syncing player position to %s", FormatPosition(ms))
 	err := player.MprisObj.Call("org.mpris.MediaPlayer2.Player.Play", dbus.FlagNoAutoStart).Store()
 	if err != nil {
 		return err
 	}
-	err = player.MprisObj.Call("org.mpris.MediaPlayer2.Player.SetPosition", dbus.FlagNoAutoStart, player.TrackId, ms).Store()
+	previous := player.seekMethod
+	method, err := player.seek(ms)
 	if err != nil {
 		return err
 	}
+	if method != previous && method != seekMethods[0].name {
+		// the player needs a fallback, which is worth knowing when it
+		// misbehaves
+		log.Printf("[WARNING] player %s could not seek with SetPosition, set the position with %s", player.BusName, method)
+	} else {
+		log.Printf("[DEBUG] set the position with %s", method)
+	}
+	player.stopListening()
 	player.setPosition(ms)
+	player.startListening()
+	player.awaitSeeked()
 	return nil
 }
 
 func (player *Player) handleSeeked(message *dbus.Signal) {
 	log.Printf("[DEBUG] handling seeked: %+v", message)
+	player.seekedDeadline = time.Time{}
 	if seeked, ok := message.Body[0].(int64); ok {
+		player.stopListening()
+		if player.restoring() {
+			player.confirmRestore(seeked)
+		}
 		player.setPosition(seeked)
+		player.startListening()
+		player.unskip(seeked)
 	} else {
 		log.Printf("[DEBUG] got invalid seeked value")
 	}
@@ -234,6 +365,8 @@ func (player *Player) handlePropertiesChanged(message *dbus.Signal) {
 	}
 }
 
+// handleNameOwnerChanged follows the bus name of the player to a new owner.
+// It returns whether to stop managing the player.
 func (player *Player) handleNameOwnerChanged(message *dbus.Signal) bool {
 	name := fmt.Sprintf("%s", message.Body[0])
 	// oldOwner := fmt.Sprintf("%s", message.Body[1])
@@ -245,13 +378,33 @@ func (player *Player) handleNameOwnerChanged(message *dbus.Signal) bool {
 
 	log.Printf("[DEBUG] handling name owner changed: %+v", message)
 
-	if newOwner != player.NameOwner {
-		// XXX: the name could actually be transferred, but I've never seen
-		// this.
-		log.Printf("[DEBUG] name owner changed from '%s' to '%s'", player.NameOwner, newOwner)
+	if newOwner == player.NameOwner {
+		return false
+	}
+
+	log.Printf("[DEBUG] name owner changed from '%s' to '%s'", player.NameOwner, newOwner)
+	if !player.processRunning() {
+		// there is no process to tell whether the player is still running
+		return true
+	}
+
+	if !player.detached {
+		player.detach()
+	}
+	if len(newOwner) == 0 {
+		log.Printf("[DEBUG] waiting for the player process to take the name again")
+		return false
+	}
+	if !player.isOwnedByChild(newOwner) {
+		log.Printf("[DEBUG] the name was taken by another process")
 		return true
 	}
 
+	err := player.reattach(newOwner)
+	if err != nil {
+		log.Printf("[WARNING] could not manage the player again: %+v", err)
+		return true
+	}
 	return false
 }
 
@@ -263,23 +416,56 @@ func (player *Player) LoadBookmark(url *model.XesamUrl) error {
 		return nil
 	}
 
-	bookmark, err := model.GetBookmark(player.DB, url)
+	bookmark, err := model.GetBookmark(player.DB, url, player.Cli.Policy)
 	if err != nil {
 		return err
 	}
 
-	if bookmark.Exists() {
-		log.Printf("[DEBUG] bookmark exists, syncing to position %s", FormatPosition(bookmark.Position))
-		//time.Sleep(100 * time.Millisecond)
-		err = player.syncPosition(bookmark.Position)
-		if err != nil {
-			log.Printf("[DEBUG] could not sync position: %+v", err)
+	player.stopListening()
+	restore := false
+	sessionPosition, fromSession := player.sessionPosition(url)
+	// new bookmarks can start after an intro
+	if bookmark.Exists() || fromSession || bookmark.Position > 0 {
+		position := bookmark.Position
+		if bookmark.Finished == 1 {
+			// start finished files over even when the final position is kept
+			position = 0
+		}
+		if fromSession {
+			log.Printf("[DEBUG] restoring the position of the session")
+			position = sessionPosition
+		}
+		if rewound := player.Cli.Policy.ResumePosition(bookmark, position, player.now()); rewound != position {
+			log.Printf("[DEBUG] rewinding %s to pick up where we left off", FormatPosition(position-rewound))
+			position = rewound
 		}
+		if player.Cli.SectionStartFlag {
+			if i := bookmark.ChapterIndex(position); i != -1 {
+				log.Printf("[DEBUG] rewinding to the start of %s", bookmark.ChapterName(i))
+				position = bookmark.Chapters[i].Position
+			}
+		}
+		log.Printf("[DEBUG] bookmark exists, restoring position %s", FormatPosition(position))
+		bookmark.Position = position
+		restore = true
 	} else {
 		log.Printf("[DEBUG] bookmark does not exist, not restoring")
 	}
 
+	player.rememberPlayerCmd(bookmark)
 	player.Bookmark = bookmark
+	player.restore = nil
+	if restore {
+		player.startRestore(bookmark.Position)
+	}
+	player.restoreSettings()
+	player.startListening()
+	player.loadSegments()
+	player.queued, err = model.IsQueued(player.DB, url)
+	if err != nil {
+		log.Printf("[DEBUG] could not check the queue: %+v", err)
+	}
+	player.saveSession()
 	player.logCurrentBookmark()
 
 	return nil
@@ -291,70 +477,74 @@ func (player *Player) updateBookmark() error {
 		return nil
 	}
 
+	player.stopListening()
+	defer player.startListening()
+
 	position := player.currentPosition()
+	if player.restoring() {
+		// the player is not at the position of the bookmark yet
+		position = player.restore.position
+	}
 	log.Printf("[DEBUG] saving bookmark to position: %s", FormatPosition(position))
 	player.Bookmark.Position = position
+	player.rememberSettings()
 	player.logCurrentBookmark()
-	return player.Bookmark.Save(player.DB)
-}
-
-var signalHandlersInstalled bool
-
-func (player *Player) installSignalHandlers() {
-	if signalHandlersInstalled {
-		return
+	err := player.Bookmark.Save(player.DB)
+	if err != nil {
+		return err
 	}
+	player.saveSession()
+	return nil
+}
 
-	go func() {
-		signals := make(chan os.Signal, 10)
-		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-		for {
-			s := <-signals
-			if player.Cmd != nil {
-				err := player.Cmd.Process.Signal(s)
-				if err != nil {
-					log.Printf("[WARNING] could not send signal to player process: %+v", err)
-					player.ExitCode = 130
-					player.Signals <- nil
-				}
-			} else {
-				player.ExitCode = 130
-				player.Signals <- nil
-			}
+// handleStop handles a request of the supervisor to stop. A player that
+// playerbm launched gets the signal and its bookmark is saved when it exits.
+// It returns whether to stop managing the player now.
+func (player *Player) handleStop(s os.Signal) bool {
+	if player.processRunning() {
+		err := player.Cmd.Process.Signal(s)
+		if err == nil {
+			return false
 		}
-	}()
-
-	signalHandlersInstalled = true
+		log.Printf("[WARNING] could not send signal to player process: %+v", err)
+	}
+	player.ExitCode = 130
+	return true
 }
 
-var matchSignalAdded bool
-
-func (player *Player) addNameOwnerChangedMatchSignal() error {
-	if matchSignalAdded {
-		return nil
+// processFinished records how the player process exited once it was received
+// from ProcessFinish.
+func (player *Player) processFinished(err error) error {
+	player.ProcessFinish = nil
+	if player.Cmd != nil && player.Cmd.ProcessState != nil {
+		player.ExitCode = player.Cmd.ProcessState.ExitCode()
 	}
+	return err
+}
 
-	err := player.Bus.AddMatchSignal(
-		dbus.WithMatchSender("org.freedesktop.DBus"),
-		dbus.WithMatchInterface("org.freedesktop.DBus"),
-		dbus.WithMatchObjectPath("/org/freedesktop/DBus"),
-		dbus.WithMatchMember("NameOwnerChanged"),
-	)
-	if err != nil {
-		return err
+// setBusName sets the bus name of the player which the supervisor routes the
+// changes of its owner by.
+func (player *Player) setBusName(name string) {
+	player.BusName = name
+	if player.supervisor != nil {
+		player.supervisor.setRoute(player, player.BusName, player.NameOwner)
 	}
+}
 
-	matchSignalAdded = true
-	return nil
+// setNameOwner sets the unique name of the bus connection of the player which
+// the supervisor routes its signals by.
+func (player *Player) setNameOwner(owner string) {
+	player.NameOwner = owner
+	if player.supervisor != nil {
+		player.supervisor.setRoute(player, player.BusName, player.NameOwner)
+	}
 }
 
 func (player *Player) initProcess() error {
-	busObj := player.Bus.BusObject()
-
-	err := player.addNameOwnerChangedMatchSignal()
-	if err != nil {
-		return err
+	if player.supervisor == nil {
+		return errors.New("the player is not supervised")
 	}
+	busObj := player.Bus.BusObject()
 
 	// listen to any property changed signals of media players
 	playerPropertiesMatch := []dbus.MatchOption{
@@ -362,42 +552,29 @@ func (player *Player) initProcess() error {
 		dbus.WithMatchObjectPath(mprisPath),
 		dbus.WithMatchMember("PropertiesChanged"),
 	}
-	err = player.Bus.AddMatchSignal(playerPropertiesMatch...)
+	err := player.Bus.AddMatchSignal(playerPropertiesMatch...)
 	if err != nil {
 		return err
 	}
 	defer player.Bus.RemoveMatchSignal(playerPropertiesMatch...)
 
-	signals := make(chan *dbus.Signal, 10)
-	player.Bus.Signal(signals)
-	defer player.Bus.RemoveSignal(signals)
-
-	log.Printf("[DEBUG] %s", player.Cli.PlayerCmd)
-	player.Cmd = exec.Command("/bin/bash", "-c", player.Cli.PlayerCmd)
+	playerCmd := player.launchCmd()
+	log.Printf("[DEBUG] %s", playerCmd)
+	player.Cmd = exec.Command("/bin/bash", "-c", playerCmd)
 	player.Cmd.Stdout = os.Stdout
 	player.Cmd.Stderr = os.Stderr
 
+	// the result is sent to the goroutine of the player, which sets the exit
+	// code
+	processFinish := player.ProcessFinish
+	cmd := player.Cmd
 	go func() {
-		err = player.Cmd.Run()
-		if player.Cmd != nil {
-			player.ExitCode = player.Cmd.ProcessState.ExitCode()
-		}
-
-		player.ProcessFinish <- err
+		processFinish <- cmd.Run()
 	}()
 
-	timeout := make(chan error, 10)
 	timeoutSeconds := time.Duration(20)
-	go func() {
-		time.Sleep(timeoutSeconds * time.Second)
-		if timeout != nil {
-			timeout <- errors.New("timeout")
-		}
-	}()
-	defer func() {
-		close(timeout)
-		timeout = nil
-	}()
+	timer := time.NewTimer(timeoutSeconds * time.Second)
+	defer timer.Stop()
 
 	signalHandler := func(message *dbus.Signal) bool {
 		log.Printf("[DEBUG] got signal: %+v", message)
@@ -412,22 +589,10 @@ func (player *Player) initProcess() error {
 
 			if len(newOwner) > 0 {
 				log.Printf("[DEBUG] a player appeared: name: %s, owner: %s", name, newOwner)
-				var pid int
-				err := busObj.Call("org.freedesktop.DBus.GetConnectionUnixProcessID", dbus.FlagNoAutoStart, name).Store(&pid)
-				if err != nil {
-					log.Printf("[DEBUG] could not get process id: %+v", err)
-					return false
-				}
-				log.Printf("[DEBUG] pid: %d", pid)
-				processMatch, err := isChildProcess(player.Cmd.Process.Pid, pid)
-				if err != nil {
-					log.Printf("[DEBUG] could not get process info: %+v", err)
-					return false
-				}
-				if processMatch {
+				if player.isOwnedByChild(newOwner) {
 					log.Printf("[DEBUG] managing player by process id detection")
-					player.BusName = name
-					player.NameOwner = newOwner
+					player.setBusName(name)
+					player.setNameOwner(newOwner)
 					player.MprisObj = player.Bus.Object(name, mprisPath)
 					return true
 				}
@@ -465,8 +630,8 @@ func (player *Player) initProcess() error {
 						}
 						if nameOwner == message.Sender {
 							log.Printf("[DEBUG] managing player with bus name: %s", busName)
-							player.BusName = busName
-							player.NameOwner = nameOwner
+							player.setBusName(busName)
+							player.setNameOwner(nameOwner)
 							player.MprisObj = player.Bus.Object(busName, mprisPath)
 							return true
 						}
@@ -483,15 +648,18 @@ func (player *Player) initProcess() error {
 loop:
 	for {
 		select {
-		case message := <-signals:
+		case message := <-player.Signals:
 			if signalHandler(message) {
 				break loop
 			}
 		case err = <-player.ProcessFinish:
-			close(player.ProcessFinish)
-			player.ProcessFinish = nil
+			err = player.processFinished(err)
 			break loop
-		case err = <-timeout:
+		case s := <-player.stop:
+			// the process gets the signal and finishes
+			player.handleStop(s)
+		case <-timer.C:
+			err = errors.New("timeout")
 			break loop
 		}
 	}
@@ -513,11 +681,19 @@ loop:
 	loop2:
 		for {
 			select {
-			case message := <-signals:
+			case message := <-player.Signals:
 				if signalHandler(message) {
 					break loop2
 				}
-			case err = <-timeout:
+			case s := <-player.stop:
+				if player.handleStop(s) {
+					return &PlayerCmdError{
+						err:      "interrupted before the player started",
+						ExitCode: player.ExitCode,
+					}
+				}
+			case <-timer.C:
+				err = errors.New("timeout")
 				break loop2
 			}
 		}
@@ -539,6 +715,15 @@ loop:
 }
 
 func (player *Player) RunCmd() error {
+	for {
+		err := player.runCmdOnce()
+		if err != nil || !player.relaunch() {
+			return err
+		}
+	}
+}
+
+func (player *Player) runCmdOnce() error {
 	err := player.initProcess()
 	if err != nil {
 		return err
@@ -548,6 +733,7 @@ func (player *Player) RunCmd() error {
 		return err
 	}
 
+	player.initSession(properties)
 	player.syncBookmark(properties)
 
 	err = player.Manage()
@@ -556,9 +742,9 @@ func (player *Player) RunCmd() error {
 	}
 
 	if player.ProcessFinish != nil {
-		return <-player.ProcessFinish
+		return player.processFinished(<-player.ProcessFinish)
 	} else {
-		return nil
+		return player.processErr
 	}
 }
 
@@ -568,6 +754,7 @@ func (player *Player) HasBookmark() bool {
 
 func (player *Player) SaveBookmark() error {
 	if player.Bookmark != nil {
+		player.rememberSettings()
 		return player.Bookmark.Save(player.DB)
 	}
 
@@ -581,7 +768,7 @@ func (player *Player) SetName(name string) {
 
 	log.Printf("[DEBUG] loading player named: %s", name)
 
-	player.BusName = name
+	player.setBusName(name)
 	player.MprisObj = player.Bus.Object(name, mprisPath)
 }
 
@@ -601,7 +788,7 @@ func (player *Player) EnsureBookmark() error {
 	player.TrackId = properties.TrackId
 
 	if properties.Url != nil {
-		bookmark, err := model.GetBookmark(player.DB, properties.Url)
+		bookmark, err := model.GetBookmark(player.DB, properties.Url, player.Cli.Policy)
 		if err != nil {
 			return err
 		}
@@ -609,6 +796,8 @@ func (player *Player) EnsureBookmark() error {
 			bookmark.Length = properties.Length
 		}
 		player.Bookmark = bookmark
+		player.syncTags(properties)
+		player.syncSettings(properties)
 	} else {
 		return errors.New("player does not have a valid url")
 	}
@@ -616,37 +805,93 @@ func (player *Player) EnsureBookmark() error {
 	return nil
 }
 
-func (player *Player) Manage() error {
-	player.installSignalHandlers()
-	err := player.addNameOwnerChangedMatchSignal()
+// Attach takes over a player that is already running. The bookmark for the
+// url it is playing is restored like it is for a player that was launched.
+func (player *Player) Attach() error {
+	properties, err := player.GetPropertiesRemote()
 	if err != nil {
 		return err
 	}
 
+	player.SetPlayerProperties(properties)
+	if properties.Url == nil {
+		log.Printf("[DEBUG] the player is not playing anything yet")
+		return nil
+	}
+
+	return player.LoadBookmark(properties.Url)
+}
+
+// Manage saves the bookmark of the player until it goes away. The player must
+// be added to a supervisor first.
+func (player *Player) Manage() error {
+	if player.supervisor == nil {
+		return errors.New("the player is not supervised")
+	}
+
 	if len(player.NameOwner) == 0 {
-		err = player.Bus.BusObject().Call(
+		var owner string
+		err := player.Bus.BusObject().Call(
 			"org.freedesktop.DBus.GetNameOwner", 0, player.BusName,
-		).Store(&player.NameOwner)
+		).Store(&owner)
 		if err != nil {
 			return err
 		}
+		player.setNameOwner(owner)
 	}
 
-	// start the main loop
-	player.Bus.Signal(player.Signals)
-	defer player.Bus.RemoveSignal(player.Signals)
-
-	err = player.Bus.AddMatchSignal(
-		dbus.WithMatchSender(player.NameOwner),
-		dbus.WithMatchObjectPath(mprisPath),
-	)
+	err := player.Bus.AddMatchSignal(ownerMatch(player.NameOwner)...)
 	if err != nil {
 		return err
 	}
+	// the owner is the one at the end after the player was detached or
+	// attached again
+	defer player.unwatchOwner()
+
+	// the Seeked signal for a position set before now could not be received
+	player.seekedDeadline = time.Time{}
+
+	skipTicker := time.NewTicker(skipCheckInterval)
+	defer skipTicker.Stop()
+	pollTicker := time.NewTicker(minPollInterval)
+	defer pollTicker.Stop()
 
-	for message := range player.Signals {
-		if message == nil {
-			break
+loop:
+	for {
+		// the process is only watched while the player is away from the bus
+		var processFinish chan error
+		if player.detached {
+			processFinish = player.ProcessFinish
+		}
+
+		var message *dbus.Signal
+		select {
+		case message = <-player.Signals:
+		case <-skipTicker.C:
+			if !player.detached {
+				player.stepRestore()
+				player.checkSkip()
+			}
+			continue
+		case <-pollTicker.C:
+			if !player.detached {
+				player.poll()
+			}
+			continue
+		case s := <-player.stop:
+			if player.handleStop(s) {
+				break loop
+			}
+			continue
+		case properties := <-player.updates:
+			if !player.detached {
+				player.syncBookmark(properties)
+			}
+			continue
+		case err := <-processFinish:
+			log.Printf("[DEBUG] the player process exited, shutting down")
+			player.processErr = player.processFinished(err)
+			break loop
 		}
 
 		if message.Sender == player.NameOwner && message.Path == mprisPath {
@@ -661,11 +906,16 @@ func (player *Player) Manage() error {
 		} else if message.Name == "org.freedesktop.DBus.NameOwnerChanged" && message.Sender == "org.freedesktop.DBus" {
 			if player.handleNameOwnerChanged(message) {
 				log.Printf("[DEBUG] name lost, shutting down")
-				break
+				break loop
 			}
 		}
 	}
 
+	if player.detached {
+		// the bookmark was saved when the player left the bus
+		return nil
+	}
+
 	err = player.updateBookmark()
 	if err != nil {
 		return err
@@ -0,0 +1,541 @@
+package player
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/altdesktop/playerbm/internal/cli"
+	"github.com/altdesktop/playerbm/internal/model"
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/require"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	time time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.time
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.time = clock.time.Add(d)
+}
+
+func TestCurrentPositionRate(t *testing.T) {
+	clock := &fakeClock{time: time.Unix(1600000000, 0)}
+	player := New(nil, nil, nil)
+	player.now = clock.Now
+	player.Status = Playing
+	player.setPosition(int64(60e+6))
+
+	clock.Advance(10 * time.Second)
+	require.Equal(t, int64(70e+6), player.currentPosition())
+
+	properties := parseProperties(map[string]dbus.Variant{
+		"Rate": dbus.MakeVariant(1.5),
+	})
+	require.True(t, properties.HasRate)
+	player.setRate(properties.Rate)
+	clock.Advance(10 * time.Second)
+	require.Equal(t, int64(85e+6), player.currentPosition(),
+		"Time before the rate changed should be played at the old rate")
+
+	player.setRate(2)
+	clock.Advance(30 * time.Second)
+	require.Equal(t, int64(145e+6), player.currentPosition())
+
+	player.Position = player.currentPosition()
+	player.Status = Paused
+	clock.Advance(time.Minute)
+	require.Equal(t, int64(145e+6), player.currentPosition(), "The position should not move while paused")
+
+	properties = parseProperties(map[string]dbus.Variant{
+		"Rate": dbus.MakeVariant(0.0),
+	})
+	require.False(t, properties.HasRate, "A rate of zero should be ignored")
+}
+
+func TestPollInterval(t *testing.T) {
+	require.Equal(t, minPollInterval, nextPollInterval(0, false))
+	require.Equal(t, 2*minPollInterval, nextPollInterval(minPollInterval, false))
+	require.Equal(t, maxPollInterval, nextPollInterval(maxPollInterval, false))
+	require.Equal(t, minPollInterval, nextPollInterval(maxPollInterval, true))
+}
+
+func TestDriftAndQuirks(t *testing.T) {
+	clock := &fakeClock{time: time.Unix(1600000000, 0)}
+	player := New(nil, nil, nil)
+	player.now = clock.Now
+	player.Status = Playing
+	player.setPosition(int64(10e+6))
+
+	clock.Advance(5 * time.Second)
+	require.False(t, player.correctDrift(int64(15.5e+6)), "Small differences should not be corrected")
+	require.Equal(t, int64(15e+6), player.currentPosition())
+	require.True(t, player.correctDrift(int64(120e+6)))
+	require.Equal(t, int64(120e+6), player.currentPosition())
+
+	player.awaitSeeked()
+	clock.Advance(time.Second)
+	player.checkQuirks()
+	require.False(t, player.polling)
+	clock.Advance(seekedTimeout)
+	player.checkQuirks()
+	require.True(t, player.polling, "Players that do not send Seeked should be polled")
+}
+
+// fakeMprisObject answers method calls with the results of a function and
+// records the methods that were called.
+type fakeMprisObject struct {
+	dbus.BusObject
+	mu     sync.Mutex
+	calls  []string
+	answer func(method string, args ...interface{}) *dbus.Call
+}
+
+func (obj *fakeMprisObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	obj.calls = append(obj.calls, method)
+	return obj.answer(method, args...)
+}
+
+func (obj *fakeMprisObject) callCount(method string) int {
+	obj.mu.Lock()
+	defer obj.mu.Unlock()
+	count := 0
+	for _, call := range obj.calls {
+		if call == method {
+			count++
+		}
+	}
+	return count
+}
+
+func TestSeekFallbacks(t *testing.T) {
+	var seekOffset int64
+	obj := &fakeMprisObject{}
+	obj.answer = func(method string, args ...interface{}) *dbus.Call {
+		switch method {
+		case "org.freedesktop.DBus.Properties.GetAll":
+			return &dbus.Call{Body: []interface{}{map[string]dbus.Variant{
+				"Position": dbus.MakeVariant(int64(30e+6)),
+				"Metadata": dbus.MakeVariant(map[string]dbus.Variant{
+					"mpris:trackid": dbus.MakeVariant(noTrack),
+				}),
+			}}}
+		case "org.mpris.MediaPlayer2.Player.Seek":
+			seekOffset = args[0].(int64)
+			return &dbus.Call{}
+		}
+		return &dbus.Call{Err: errors.New("not supported")}
+	}
+
+	player := New(nil, nil, nil)
+	player.MprisObj = obj
+	player.TrackId = noTrack
+
+	method, err := player.seek(int64(100e+6))
+	require.NoError(t, err)
+	require.Equal(t, "Seek", method)
+	require.Equal(t, int64(70e+6), seekOffset, "The offset should be from the position of the player")
+
+	obj.calls = nil
+	_, err = player.seek(int64(100e+6))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"org.freedesktop.DBus.Properties.GetAll",
+		"org.mpris.MediaPlayer2.Player.Seek",
+	}, obj.calls, "The method that worked should be tried first")
+
+	obj.answer = func(method string, args ...interface{}) *dbus.Call {
+		return &dbus.Call{Err: errors.New("not supported")}
+	}
+	_, err = player.seek(int64(100e+6))
+	require.Error(t, err)
+}
+
+func TestRestoreRetries(t *testing.T) {
+	clock := &fakeClock{time: time.Unix(1600000000, 0)}
+	var position int64
+	var seeks int
+	obj := &fakeMprisObject{}
+	obj.answer = func(method string, args ...interface{}) *dbus.Call {
+		switch method {
+		case "org.freedesktop.DBus.Properties.GetAll":
+			return &dbus.Call{Body: []interface{}{map[string]dbus.Variant{
+				"Position": dbus.MakeVariant(position),
+			}}}
+		case "org.mpris.MediaPlayer2.Player.SetPosition":
+			seeks++
+			// the player drops the first seek because it is not ready
+			if seeks > 1 {
+				position = args[1].(int64)
+			}
+		}
+		return &dbus.Call{}
+	}
+
+	player := New(nil, nil, nil)
+	player.now = clock.Now
+	player.MprisObj = obj
+	player.TrackId = "/track/1"
+	player.Status = Paused
+	player.CanSeek = false
+
+	player.startRestore(int64(300e+6))
+	require.True(t, player.restoring())
+	require.Equal(t, 0, seeks, "The player should not seek before it is ready")
+
+	player.CanSeek = true
+	player.Length = int64(600e+6)
+	player.stepRestore()
+	require.Equal(t, 1, seeks)
+
+	clock.Advance(confirmTimeout)
+	player.stepRestore()
+	require.True(t, player.restoring(), "The dropped seek should not confirm the restore")
+	require.Equal(t, int64(0), player.currentPosition())
+
+	player.stepRestore()
+	require.Equal(t, 1, seeks, "The retry should wait for the backoff")
+	clock.Advance(retryBackoff)
+	player.stepRestore()
+	require.Equal(t, 2, seeks)
+
+	player.confirmRestore(int64(300e+6))
+	require.False(t, player.restoring())
+	require.Equal(t, int64(300e+6), player.currentPosition())
+}
+
+func TestStartFlags(t *testing.T) {
+	url := model.FileUrl("/books/war and peace.mp3")
+
+	cmd, ok := withStartFlag("mpv --no-video '/books/war and peace.mp3'", url, int64(90.5e+6))
+	require.True(t, ok)
+	require.Equal(t, "mpv --start=90.500 --no-video '/books/war and peace.mp3'", cmd)
+
+	cmd, ok = withStartFlag("/usr/bin/mplayer '/books/war and peace.mp3'", url, int64(60e+6))
+	require.True(t, ok)
+	require.Equal(t, "/usr/bin/mplayer -ss 60.000 '/books/war and peace.mp3'", cmd)
+
+	_, ok = withStartFlag("mpv /books/other.mp3", url, int64(60e+6))
+	require.False(t, ok, "The flag should only be added for the url")
+	_, ok = withStartFlag("xdg-open '/books/war and peace.mp3'", url, int64(60e+6))
+	require.False(t, ok)
+}
+
+func TestPlayerCmdTemplate(t *testing.T) {
+	url := model.FileUrl("/books/war and peace.mp3")
+
+	template := PlayerCmdTemplate("mpv --no-video '/books/war and peace.mp3'", url)
+	require.Equal(t, "mpv --no-video {}", template)
+	require.Equal(t, "", PlayerCmdTemplate("mpv /books/other.mp3", url), "Commands that do not open the url should not be remembered")
+
+	cmd, err := FillPlayerCmd(template, model.FileUrl("/books/anna karenina.mp3"))
+	require.NoError(t, err)
+	require.Equal(t, "mpv --no-video '/books/anna karenina.mp3'", cmd)
+
+	cmd, err = FillPlayerCmd("vlc --rate=1.5", url)
+	require.NoError(t, err)
+	require.Equal(t, "vlc --rate=1.5 '/books/war and peace.mp3'", cmd, "The url should be added when there is no placeholder")
+}
+
+func TestDefaultPlayers(t *testing.T) {
+	players := DefaultPlayers{
+		".m4b":    "mpv --no-video {}",
+		"audio/*": "mpv {}",
+		"https":   "firefox {}",
+	}
+
+	cmd, ok := players.Cmd(model.FileUrl("/books/war and peace.M4B"))
+	require.True(t, ok)
+	require.Equal(t, "mpv --no-video {}", cmd, "The extension should come before the MIME type")
+
+	cmd, ok = players.Cmd(model.FileUrl("/podcasts/episode.mp3"))
+	require.True(t, ok)
+	require.Equal(t, "mpv {}", cmd)
+
+	url, err := model.ParseXesamUrl("https://example.com/talk.mp3")
+	require.NoError(t, err)
+	cmd, ok = players.Cmd(url)
+	require.True(t, ok)
+	require.Equal(t, "firefox {}", cmd)
+
+	_, ok = players.Cmd(model.FileUrl("/videos/movie.mkv"))
+	require.False(t, ok)
+	players["default"] = "vlc {}"
+	cmd, ok = players.Cmd(model.FileUrl("/videos/movie.mkv"))
+	require.True(t, ok)
+	require.Equal(t, "vlc {}", cmd)
+
+	require.NoError(t, CheckDefaultPlayerKey("video/mp4"))
+	require.Error(t, CheckDefaultPlayerKey("video/"))
+	require.Error(t, CheckDefaultPlayerKey("*"))
+}
+
+func TestOpenTarget(t *testing.T) {
+	names := []string{"mpv", "vlc.instance1234"}
+	name, ok := MatchPlayerName(names, "vlc")
+	require.True(t, ok)
+	require.Equal(t, "vlc.instance1234", name)
+	name, ok = MatchPlayerName(names, "org.mpris.MediaPlayer2.mpv")
+	require.True(t, ok)
+	require.Equal(t, "mpv", name)
+	_, ok = MatchPlayerName(names, "mpv --no-video {}")
+	require.False(t, ok, "Player commands should not match running players")
+	require.Equal(t, "mpv", CommandProgram("/usr/bin/mpv --no-video {}"))
+	require.Equal(t, "", CommandProgram(""))
+
+	obj := &fakeMprisObject{answer: func(method string, args ...interface{}) *dbus.Call {
+		return &dbus.Call{Body: []interface{}{map[string]dbus.Variant{
+			"SupportedUriSchemes": dbus.MakeVariant([]string{"file", "http"}),
+			"SupportedMimeTypes":  dbus.MakeVariant([]string{"audio/mpeg", "audio/ogg"}),
+		}}}
+	}}
+	player := New(nil, nil, nil)
+	player.MprisObj = obj
+
+	supported, err := player.Supports(model.FileUrl("/podcasts/episode.mp3"))
+	require.NoError(t, err)
+	require.True(t, supported)
+	supported, err = player.Supports(model.FileUrl("/videos/movie.mkv"))
+	require.NoError(t, err)
+	require.False(t, supported)
+	url, err := model.ParseXesamUrl("https://example.com/talk.mp3")
+	require.NoError(t, err)
+	supported, err = player.Supports(url)
+	require.NoError(t, err)
+	require.False(t, supported)
+}
+
+func TestRestoreAlreadyAtPosition(t *testing.T) {
+	obj := &fakeMprisObject{answer: func(method string, args ...interface{}) *dbus.Call {
+		return &dbus.Call{}
+	}}
+	player := New(nil, nil, nil)
+	player.MprisObj = obj
+	player.Length = int64(600e+6)
+	player.setPosition(int64(300e+6))
+
+	player.startRestore(int64(300e+6))
+	require.False(t, player.restoring())
+	require.Empty(t, obj.calls, "The player should not seek when it started at the position")
+}
+
+// requireNoSignal fails when the player gets a signal soon.
+func requireNoSignal(t *testing.T, player *Player, msgAndArgs ...interface{}) {
+	select {
+	case message := <-player.Signals:
+		require.Fail(t, fmt.Sprintf("unexpected signal %s", message.Name), msgAndArgs...)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSupervisorRoutes(t *testing.T) {
+	supervisor := &Supervisor{routes: map[*Player]*route{}}
+	mpv := New(nil, nil, nil)
+	vlc := New(nil, nil, nil)
+	launching := New(nil, nil, nil)
+	supervisor.Add(mpv)
+	supervisor.Add(vlc)
+	supervisor.Add(launching)
+	mpv.setBusName("org.mpris.MediaPlayer2.mpv")
+	mpv.setNameOwner(":1.10")
+	vlc.setBusName("org.mpris.MediaPlayer2.vlc")
+	vlc.setNameOwner(":1.20")
+
+	seeked := &dbus.Signal{Sender: ":1.20", Name: "org.mpris.MediaPlayer2.Player.Seeked"}
+	supervisor.route(seeked)
+	require.Equal(t, seeked, <-vlc.Signals)
+	requireNoSignal(t, mpv, "Signals should only go to the player that sent them")
+	requireNoSignal(t, launching)
+
+	other := &dbus.Signal{Sender: ":1.30", Name: "org.freedesktop.DBus.Properties.PropertiesChanged"}
+	supervisor.route(other)
+	require.Equal(t, other, <-launching.Signals, "Players being launched should get the signals of unknown players")
+	requireNoSignal(t, mpv)
+
+	ownerChanged := &dbus.Signal{
+		Sender: "org.freedesktop.DBus",
+		Name:   "org.freedesktop.DBus.NameOwnerChanged",
+		Body:   []interface{}{"org.mpris.MediaPlayer2.vlc", ":1.20", ""},
+	}
+	supervisor.route(ownerChanged)
+	require.Equal(t, ownerChanged, <-vlc.Signals)
+	require.Equal(t, ownerChanged, <-launching.Signals, "Players being launched should get the changes of every name")
+	requireNoSignal(t, mpv, "Changes of a name should only go to the player with the name")
+
+	mpv.setNameOwner("")
+	supervisor.route(other)
+	require.Equal(t, other, <-launching.Signals)
+	requireNoSignal(t, mpv, "Detached players should not get the signals of unknown players")
+
+	// more signals than the channel of the player holds
+	for i := 0; i < 2*cap(vlc.Signals); i++ {
+		supervisor.route(seeked)
+	}
+	for i := 0; i < 2*cap(vlc.Signals); i++ {
+		require.Equal(t, seeked, <-vlc.Signals, "No signal should be dropped when the player is busy")
+	}
+
+	supervisor.remove(vlc)
+	supervisor.route(seeked)
+	requireNoSignal(t, vlc, "Players that are done should not get signals")
+}
+
+// privateBus starts a bus of its own for the test and connects to it. The
+// test is skipped when there is no dbus-daemon.
+func privateBus(t *testing.T) (*dbus.Conn, func()) {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	cmd := exec.Command(daemon, "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+
+	conn, err := dbus.Dial(strings.TrimSpace(address))
+	require.NoError(t, err)
+	require.NoError(t, conn.Auth(nil))
+	require.NoError(t, conn.Hello())
+	return conn, func() {
+		conn.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
+
+func TestSupervisorInterrupt(t *testing.T) {
+	conn, done := privateBus(t)
+	defer done()
+
+	supervisor, err := NewSupervisor(conn)
+	require.NoError(t, err)
+	player := New(nil, nil, conn)
+	player.BusName = "org.mpris.MediaPlayer2.mpv"
+	player.NameOwner = ":1.10"
+	supervisor.Go(player, player.Manage)
+
+	interrupts := make(chan os.Signal, 1)
+	go supervisor.handleInterrupts(interrupts)
+	interrupts <- syscall.SIGINT
+
+	exitCode, err := supervisor.Wait()
+	require.NoError(t, err)
+	require.Equal(t, 130, exitCode, "Interrupted players should exit like playerbm was interrupted")
+}
+
+func TestManagePropertiesChanged(t *testing.T) {
+	conn, done := privateBus(t)
+	defer done()
+
+	obj := &fakeMprisObject{answer: func(method string, args ...interface{}) *dbus.Call {
+		return &dbus.Call{Body: []interface{}{map[string]dbus.Variant{
+			"PlaybackStatus": dbus.MakeVariant(Paused),
+			"Position":       dbus.MakeVariant(int64(42e+6)),
+		}}}
+	}}
+	supervisor, err := NewSupervisor(conn)
+	require.NoError(t, err)
+	player := New(&cli.PbmCli{}, nil, conn)
+	player.BusName = "org.mpris.MediaPlayer2.mpv"
+	player.NameOwner = ":1.10"
+	player.MprisObj = obj
+	supervisor.Go(player, player.Manage)
+
+	statusChanged := func(status string) *dbus.Signal {
+		return &dbus.Signal{
+			Sender: ":1.10",
+			Path:   mprisPath,
+			Name:   "org.freedesktop.DBus.Properties.PropertiesChanged",
+			Body: []interface{}{"org.mpris.MediaPlayer2.Player", map[string]dbus.Variant{
+				"PlaybackStatus": dbus.MakeVariant(status),
+			}, []string{}},
+		}
+	}
+	// each change makes the player get all the properties in the background
+	supervisor.route(statusChanged(Playing))
+	supervisor.route(statusChanged(Paused))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for obj.callCount("org.freedesktop.DBus.Properties.GetAll") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, 2, obj.callCount("org.freedesktop.DBus.Properties.GetAll"))
+	time.Sleep(100 * time.Millisecond)
+
+	interrupts := make(chan os.Signal, 1)
+	go supervisor.handleInterrupts(interrupts)
+	interrupts <- syscall.SIGINT
+	_, err = supervisor.Wait()
+	require.NoError(t, err)
+	require.Equal(t, Paused, player.Status)
+	require.Equal(t, int64(42e+6), player.Position, "The properties got in the background should be synced by the player")
+}
+
+func TestNameOwnerChanged(t *testing.T) {
+	ownerChanged := func(owner string) *dbus.Signal {
+		return &dbus.Signal{
+			Sender: "org.freedesktop.DBus",
+			Name:   "org.freedesktop.DBus.NameOwnerChanged",
+			Body:   []interface{}{"org.mpris.MediaPlayer2.mpv", ":1.10", owner},
+		}
+	}
+
+	attached := New(nil, nil, nil)
+	attached.BusName = "org.mpris.MediaPlayer2.mpv"
+	attached.NameOwner = ":1.10"
+	require.True(t, attached.handleNameOwnerChanged(ownerChanged("")), "Players without a process should stop when the name is lost")
+
+	wrapped := New(nil, nil, nil)
+	wrapped.BusName = "org.mpris.MediaPlayer2.mpv"
+	wrapped.NameOwner = ":1.10"
+	wrapped.Cmd = &exec.Cmd{}
+	require.False(t, wrapped.handleNameOwnerChanged(ownerChanged("")), "Players should be waited for while their process runs")
+	require.True(t, wrapped.detached)
+	require.Equal(t, "", wrapped.NameOwner)
+
+	require.True(t, wrapped.handleNameOwnerChanged(ownerChanged(":1.20")), "A name taken by another process should stop the player")
+}
+
+func TestCommandUrlsEmpty(t *testing.T) {
+	require.Empty(t, commandUrls(""))
+	require.Empty(t, commandUrls("   "))
+}
+
+func TestSkipFailure(t *testing.T) {
+	obj := &fakeMprisObject{answer: func(method string, args ...interface{}) *dbus.Call {
+		return &dbus.Call{Err: errors.New("not supported")}
+	}}
+	player := New(nil, nil, nil)
+	player.MprisObj = obj
+	player.Status = Playing
+	player.Length = int64(600e+6)
+	player.loadSegments()
+	player.segments = []model.Segment{{Start: 0, End: int64(30e+6)}}
+	player.setPosition(int64(10e+6))
+
+	player.checkSkip()
+	calls := len(obj.calls)
+	require.NotZero(t, calls)
+	player.checkSkip()
+	require.Len(t, obj.calls, calls, "A segment the player could not skip should not be tried again")
+
+	player.setPosition(int64(60e+6))
+	player.checkSkip()
+	player.setPosition(int64(10e+6))
+	player.checkSkip()
+	require.Greater(t, len(obj.calls), calls, "The segment should be tried again after playback left it")
+}
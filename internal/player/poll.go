@@ -0,0 +1,89 @@
+package player
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// the interval to poll the position of players that need it while the
+	// position keeps matching the extrapolated position
+	maxPollInterval = 10 * time.Second
+	// the interval to poll the position right after it drifted
+	minPollInterval = time.Second
+	// how long to wait for the Seeked signal after setting the position
+	seekedTimeout = 2 * time.Second
+	// the difference to the extrapolated position that is corrected
+	driftThreshold = int64(2e+6)
+)
+
+// nextPollInterval polls quickly after the position drifted, as it does while
+// the user scrubs, and backs off while it does not.
+func nextPollInterval(interval time.Duration, drifted bool) time.Duration {
+	if drifted {
+		return minPollInterval
+	}
+	interval *= 2
+	if interval > maxPollInterval {
+		interval = maxPollInterval
+	}
+	if interval < minPollInterval {
+		interval = minPollInterval
+	}
+	return interval
+}
+
+// correctDrift sets the position the player reported if it is too far from
+// the extrapolated position. It returns whether the position drifted.
+func (player *Player) correctDrift(position int64) bool {
+	drift := position - player.currentPosition()
+	if abs(drift) < driftThreshold {
+		return false
+	}
+
+	log.Printf("[DEBUG] correcting position drift of %.1fs to %s", float64(drift)/1e+6, FormatPosition(position))
+	player.stopListening()
+	player.setPosition(position)
+	player.startListening()
+	player.unskip(position)
+	return true
+}
+
+// awaitSeeked expects the player to send the Seeked signal soon because the
+// position was set.
+func (player *Player) awaitSeeked() {
+	player.seekedDeadline = player.now().Add(seekedTimeout)
+}
+
+// checkQuirks turns on polling for players that do not send the Seeked signal
+// when the position changes.
+func (player *Player) checkQuirks() {
+	if player.polling || player.seekedDeadline.IsZero() || player.now().Before(player.seekedDeadline) {
+		return
+	}
+	log.Printf("[DEBUG] the player did not send Seeked after the position was set, polling the position")
+	player.polling = true
+	player.seekedDeadline = time.Time{}
+}
+
+// poll gets the position from the player when it is due and fixes the
+// extrapolated position if it drifted.
+func (player *Player) poll() {
+	player.checkQuirks()
+	if !player.polling || player.Status != Playing || player.now().Before(player.nextPoll) {
+		return
+	}
+
+	properties, err := player.GetPropertiesRemote()
+	if err != nil {
+		log.Printf("[DEBUG] could not poll the position: %+v", err)
+		return
+	}
+
+	drifted := false
+	if properties.HasPosition && properties.Status == Playing {
+		drifted = player.correctDrift(properties.Position)
+	}
+	player.pollInterval = nextPollInterval(player.pollInterval, drifted)
+	player.nextPoll = player.now().Add(player.pollInterval)
+}
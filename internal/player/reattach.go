@@ -0,0 +1,104 @@
+package player
+
+import (
+	"github.com/godbus/dbus/v5"
+	"log"
+	"time"
+)
+
+// processRunning is whether the player command that playerbm launched is
+// still running.
+func (player *Player) processRunning() bool {
+	return player.Cmd != nil && player.ProcessFinish != nil
+}
+
+// isOwnedByChild is whether the bus connection belongs to the process of the
+// player command or one of its children.
+func (player *Player) isOwnedByChild(owner string) bool {
+	if player.Cmd == nil || player.Cmd.Process == nil {
+		return false
+	}
+
+	var pid int
+	err := player.Bus.BusObject().Call("org.freedesktop.DBus.GetConnectionUnixProcessID", dbus.FlagNoAutoStart, owner).Store(&pid)
+	if err != nil {
+		log.Printf("[DEBUG] could not get process id: %+v", err)
+		return false
+	}
+	log.Printf("[DEBUG] pid: %d", pid)
+
+	processMatch, err := isChildProcess(player.Cmd.Process.Pid, pid)
+	if err != nil {
+		log.Printf("[DEBUG] could not get process info: %+v", err)
+		return false
+	}
+	return processMatch
+}
+
+// ownerMatch is the match rule for the signals of the player from the owner
+// of its bus name.
+func ownerMatch(owner string) []dbus.MatchOption {
+	return []dbus.MatchOption{
+		dbus.WithMatchSender(owner),
+		dbus.WithMatchObjectPath(mprisPath),
+	}
+}
+
+// unwatchOwner removes the match rule for the signals of the owner of the bus
+// name so the bus stops sending them.
+func (player *Player) unwatchOwner() {
+	if player.Bus == nil || len(player.NameOwner) == 0 {
+		return
+	}
+	err := player.Bus.RemoveMatchSignal(ownerMatch(player.NameOwner)...)
+	if err != nil {
+		log.Printf("[DEBUG] could not remove the match rule for %s: %+v", player.NameOwner, err)
+	}
+}
+
+// detach saves the bookmark when the player lost its bus name while its
+// process is still running. The player is managed again when it takes the
+// name back.
+func (player *Player) detach() {
+	err := player.updateBookmark()
+	if err != nil {
+		log.Printf("[DEBUG] could not update current bookmark: %+v", err)
+	}
+	player.stopListening()
+	player.unwatchOwner()
+	player.setNameOwner("")
+	player.detached = true
+}
+
+// reattach manages the player again under the new owner of its bus name. The
+// new owner is a new session of the player, so the bookmark is restored like
+// it is when the player starts.
+func (player *Player) reattach(owner string) error {
+	log.Printf("[DEBUG] managing the player again with owner %s", owner)
+	err := player.Bus.AddMatchSignal(ownerMatch(owner)...)
+	if err != nil {
+		return err
+	}
+	player.setNameOwner(owner)
+	player.MprisObj = player.Bus.Object(player.BusName, mprisPath)
+
+	player.Bookmark = nil
+	player.TrackId = ""
+	player.Status = Stopped
+	player.Rate = 1
+	player.CanSeek = true
+	player.Length = 0
+	player.settings = map[string]string{}
+	player.polling = false
+	player.seekMethod = ""
+	player.seekedDeadline = time.Time{}
+	player.restore = nil
+	player.detached = false
+
+	properties, err := player.GetPropertiesRemote()
+	if err != nil {
+		return err
+	}
+	player.syncBookmark(properties)
+	return nil
+}
@@ -0,0 +1,158 @@
+package player
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	// how long to wait for the player to be ready to seek before seeking
+	// anyway
+	readyTimeout = 10 * time.Second
+	// how long to wait for the player to confirm the position after seeking
+	confirmTimeout = 3 * time.Second
+	// the wait before the first retry which doubles with every retry
+	retryBackoff = 500 * time.Millisecond
+	// how many times to seek before giving up on the restore
+	maxRestoreAttempts = 5
+)
+
+type restoreState int
+
+const (
+	// waiting for the player to be ready to seek or for the next retry
+	restoreWaiting restoreState = iota
+	// the seek was sent and the position is not confirmed yet
+	restoreSeeking
+)
+
+// A restore brings the player to the position of a bookmark. Players often
+// drop a seek that comes before they have loaded the file, so the position is
+// only restored once the player confirms it.
+type restore struct {
+	state    restoreState
+	position int64
+	attempts int
+	// when to seek in the waiting state or when to check the position in the
+	// seeking state
+	deadline time.Time
+}
+
+// restoring is whether the position of the bookmark is not restored yet. The
+// position of the player is not saved while it is.
+func (player *Player) restoring() bool {
+	return player.restore != nil
+}
+
+// startRestore restores the position once the player is ready.
+func (player *Player) startRestore(position int64) {
+	player.stopListening()
+	player.restore = &restore{
+		state:    restoreWaiting,
+		position: position,
+		deadline: player.now().Add(readyTimeout),
+	}
+	player.stepRestore()
+}
+
+// readyToSeek is whether the player looks like it has loaded the file.
+func (player *Player) readyToSeek() bool {
+	if !player.CanSeek {
+		return false
+	}
+	return player.Length > 0 || player.Status == Playing
+}
+
+// stepRestore moves the restore along when the player is ready or a deadline
+// has passed.
+func (player *Player) stepRestore() {
+	r := player.restore
+	if r == nil {
+		return
+	}
+
+	switch r.state {
+	case restoreWaiting:
+		if r.attempts == 0 && !player.readyToSeek() && player.now().Before(r.deadline) {
+			return
+		}
+		if r.attempts > 0 && player.now().Before(r.deadline) {
+			return
+		}
+		player.seekRestore()
+	case restoreSeeking:
+		if player.now().Before(r.deadline) {
+			return
+		}
+		properties, err := player.GetPropertiesRemote()
+		if err != nil || !properties.HasPosition {
+			log.Printf("[DEBUG] could not get the position to confirm the restore: %+v", err)
+			player.retryRestore()
+			return
+		}
+		player.confirmRestore(properties.Position)
+	}
+}
+
+func (player *Player) seekRestore() {
+	r := player.restore
+	if r.attempts == 0 && abs(player.currentPosition()-r.position) < driftThreshold {
+		// the player was started at the position
+		log.Printf("[DEBUG] the player is already at %s, not seeking", FormatPosition(r.position))
+		player.restore = nil
+		player.startListening()
+		return
+	}
+
+	r.attempts++
+	log.Printf("[DEBUG] restoring position %s (attempt %d)", FormatPosition(r.position), r.attempts)
+
+	err := player.syncPosition(r.position)
+	if err != nil {
+		log.Printf("[DEBUG] could not sync position: %+v", err)
+		player.retryRestore()
+		return
+	}
+
+	r.state = restoreSeeking
+	r.deadline = player.now().Add(confirmTimeout)
+}
+
+// retryRestore seeks again after a backoff or gives up after too many
+// attempts.
+func (player *Player) retryRestore() {
+	r := player.restore
+	if r.attempts >= maxRestoreAttempts {
+		fmt.Fprintf(os.Stderr, "playerbm: could not restore the position %s\n", FormatPosition(r.position))
+		player.restore = nil
+		player.startListening()
+		return
+	}
+
+	backoff := retryBackoff << uint(r.attempts-1)
+	log.Printf("[DEBUG] retrying the restore in %s", backoff)
+	r.state = restoreWaiting
+	r.deadline = player.now().Add(backoff)
+}
+
+// confirmRestore checks a position the player reported while restoring. The
+// restore is done when it matches the position after the seek.
+func (player *Player) confirmRestore(position int64) {
+	r := player.restore
+	if r == nil || r.state != restoreSeeking {
+		return
+	}
+
+	if abs(position-player.currentPosition()) >= driftThreshold {
+		log.Printf("[DEBUG] the player is at %s after restoring %s", FormatPosition(position), FormatPosition(r.position))
+		player.setPosition(position)
+		player.retryRestore()
+		return
+	}
+
+	log.Printf("[DEBUG] restored position %s", FormatPosition(r.position))
+	player.restore = nil
+	player.startListening()
+}
@@ -0,0 +1,107 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"log"
+	"strings"
+)
+
+// the trackid players give when they do not have a track id
+const noTrack = dbus.ObjectPath("/org/mpris/MediaPlayer2/TrackList/NoTrack")
+
+// A seekMethod is a way to set the position of a player. They are tried in
+// order until one works. The last one is not specific to any player but works
+// for the players that let the Position property be set.
+type seekMethod struct {
+	name string
+	seek func(player *Player, ms int64) error
+}
+
+var seekMethods = []seekMethod{
+	{"SetPosition", (*Player).seekSetPosition},
+	{"SetPosition with a new trackid", (*Player).seekNewTrackId},
+	{"Seek", (*Player).seekRelative},
+	{"the Position property", (*Player).seekPositionProperty},
+}
+
+func validTrackId(trackId dbus.ObjectPath) error {
+	if len(trackId) == 0 {
+		return errors.New("Player does not have a trackid")
+	}
+	if !trackId.IsValid() || trackId == noTrack {
+		return errors.New(fmt.Sprintf("Player has an invalid trackid: '%s'", trackId))
+	}
+	return nil
+}
+
+func (player *Player) seekSetPosition(ms int64) error {
+	err := validTrackId(player.TrackId)
+	if err != nil {
+		return err
+	}
+	return player.MprisObj.Call("org.mpris.MediaPlayer2.Player.SetPosition", dbus.FlagNoAutoStart, player.TrackId, ms).Store()
+}
+
+// seekNewTrackId gets the trackid from the player again in case the one we
+// have is stale.
+func (player *Player) seekNewTrackId(ms int64) error {
+	properties, err := player.GetPropertiesRemote()
+	if err != nil {
+		return err
+	}
+	err = validTrackId(properties.TrackId)
+	if err != nil {
+		return err
+	}
+	if properties.TrackId == player.TrackId {
+		return errors.New("the trackid did not change")
+	}
+	player.TrackId = properties.TrackId
+	return player.seekSetPosition(ms)
+}
+
+// seekRelative seeks by the offset from the position the player has now,
+// which does not need a trackid.
+func (player *Player) seekRelative(ms int64) error {
+	position := player.currentPosition()
+	properties, err := player.GetPropertiesRemote()
+	if err == nil && properties.HasPosition {
+		position = properties.Position
+	}
+	return player.MprisObj.Call("org.mpris.MediaPlayer2.Player.Seek", dbus.FlagNoAutoStart, ms-position).Store()
+}
+
+// seekPositionProperty sets the Position property. The property is read only
+// in the spec but some players allow it to be set.
+func (player *Player) seekPositionProperty(ms int64) error {
+	return player.MprisObj.Call("org.freedesktop.DBus.Properties.Set", dbus.FlagNoAutoStart,
+		"org.mpris.MediaPlayer2.Player", "Position", dbus.MakeVariant(ms)).Store()
+}
+
+// seek sets the position with the first method that works starting with the
+// one that worked last time. It returns the name of the method.
+func (player *Player) seek(ms int64) (string, error) {
+	methods := []seekMethod{}
+	for _, method := range seekMethods {
+		if method.name == player.seekMethod {
+			methods = append([]seekMethod{method}, methods...)
+		} else {
+			methods = append(methods, method)
+		}
+	}
+
+	failures := []string{}
+	for _, method := range methods {
+		err := method.seek(player, ms)
+		if err == nil {
+			player.seekMethod = method.name
+			return method.name, nil
+		}
+		log.Printf("[DEBUG] could not set the position with %s: %+v", method.name, err)
+		failures = append(failures, fmt.Sprintf("%s: %s", method.name, err))
+	}
+
+	return "", errors.New(fmt.Sprintf("could not set the position (%s)", strings.Join(failures, "; ")))
+}
@@ -0,0 +1,169 @@
+package player
+
+import (
+	"github.com/altdesktop/playerbm/internal/model"
+	"github.com/godbus/dbus/v5"
+	"github.com/kballard/go-shellquote"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+type track struct {
+	id  dbus.ObjectPath
+	url *model.XesamUrl
+}
+
+// trackList reads the playlist of a player that has the TrackList interface.
+// It returns nil if the player does not have it.
+func (player *Player) trackList() []track {
+	var hasTrackList bool
+	err := player.MprisObj.Call("org.freedesktop.DBus.Properties.Get", dbus.FlagNoAutoStart,
+		"org.mpris.MediaPlayer2", "HasTrackList").Store(&hasTrackList)
+	if err != nil || !hasTrackList {
+		return nil
+	}
+
+	var ids []dbus.ObjectPath
+	err = player.MprisObj.Call("org.freedesktop.DBus.Properties.Get", dbus.FlagNoAutoStart,
+		"org.mpris.MediaPlayer2.TrackList", "Tracks").Store(&ids)
+	if err != nil || len(ids) == 0 {
+		log.Printf("[DEBUG] could not get the tracks: %+v", err)
+		return nil
+	}
+
+	var metadata []map[string]dbus.Variant
+	err = player.MprisObj.Call("org.mpris.MediaPlayer2.TrackList.GetTracksMetadata", dbus.FlagNoAutoStart,
+		ids).Store(&metadata)
+	if err != nil {
+		log.Printf("[DEBUG] could not get the metadata of the tracks: %+v", err)
+		return nil
+	}
+
+	tracks := []track{}
+	for _, trackMetadata := range metadata {
+		properties := parseProperties(map[string]dbus.Variant{"Metadata": dbus.MakeVariant(trackMetadata)})
+		if properties.Url == nil || len(properties.TrackId) == 0 {
+			return nil
+		}
+		tracks = append(tracks, track{id: properties.TrackId, url: properties.Url})
+	}
+
+	return tracks
+}
+
+// commandUrls are the urls of the files that are passed to the player command
+// in order.
+func commandUrls(playerCmd string) []*model.XesamUrl {
+	words, err := shellquote.Split(playerCmd)
+	if err != nil || len(words) == 0 {
+		return nil
+	}
+
+	urls := []*model.XesamUrl{}
+	for _, word := range words[1:] {
+		path, err := filepath.Abs(word)
+		if err != nil {
+			continue
+		}
+		if stat, err := os.Stat(path); err == nil && stat.Mode().IsRegular() {
+			urls = append(urls, model.FileUrl(path))
+		}
+	}
+
+	return urls
+}
+
+// initSession starts a session bookmark when the player plays a playlist. If
+// the playlist was played before, the player goes to the track that was
+// playing and the position of the session is restored when the url changes.
+func (player *Player) initSession(properties *Properties) {
+	tracks := player.trackList()
+	urls := []*model.XesamUrl{}
+	if tracks != nil {
+		for _, t := range tracks {
+			urls = append(urls, t.url)
+		}
+	} else if len(player.Cli.PlayerCmd) > 0 {
+		urls = commandUrls(player.Cli.PlayerCmd)
+	}
+
+	if len(urls) < 2 {
+		return
+	}
+
+	session, err := model.GetSession(player.DB, urls)
+	if err != nil {
+		log.Printf("[DEBUG] could not get the session: %+v", err)
+		return
+	}
+	if len(player.Cli.PlayerCmd) > 0 {
+		session.PlayerCmd = player.Cli.PlayerCmd
+	}
+	player.Session = session
+	log.Printf("[DEBUG] playing a session of %d tracks", len(urls))
+
+	target := session.CurrentUrl()
+	if !session.Exists() || target == nil {
+		return
+	}
+	if properties.Url != nil && properties.Url.String() == target.String() {
+		player.restoreSession = true
+		return
+	}
+
+	log.Printf("[DEBUG] restoring session track %d: %s", session.Current+1, target)
+	if tracks != nil {
+		err = player.MprisObj.Call("org.mpris.MediaPlayer2.TrackList.GoTo", dbus.FlagNoAutoStart,
+			tracks[session.Current].id).Store()
+	} else {
+		// without a track list, step through the playlist from the track that
+		// is playing
+		current := 0
+		if properties.Url != nil {
+			current = session.Index(properties.Url)
+		}
+		for i := current; err == nil && current != -1 && i < session.Current; i++ {
+			err = player.MprisObj.Call("org.mpris.MediaPlayer2.Player.Next", dbus.FlagNoAutoStart).Store()
+		}
+	}
+	if err != nil {
+		log.Printf("[DEBUG] could not go to the session track: %+v", err)
+		return
+	}
+	player.restoreSession = true
+}
+
+// sessionPosition is the position to restore for the url if it is the track
+// of the session that is being restored.
+func (player *Player) sessionPosition(url *model.XesamUrl) (int64, bool) {
+	if !player.restoreSession || player.Session.CurrentUrl().String() != url.String() {
+		return 0, false
+	}
+	player.restoreSession = false
+	return player.Session.Position, true
+}
+
+// saveSession saves the track of the bookmark and its position to the
+// session.
+func (player *Player) saveSession() {
+	if player.Session == nil || player.Bookmark == nil {
+		return
+	}
+
+	i := player.Session.Index(player.Bookmark.Url)
+	if i == -1 {
+		return
+	}
+	if player.restoreSession && i != player.Session.Current {
+		// the player has not gone to the session track yet
+		return
+	}
+
+	player.Session.Current = i
+	player.Session.Position = player.Bookmark.Position
+	err := player.Session.Save(player.DB)
+	if err != nil {
+		log.Printf("[DEBUG] could not save the session: %+v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package player
+
+import (
+	"github.com/altdesktop/playerbm/internal/model"
+	"github.com/godbus/dbus/v5"
+	"log"
+	"strconv"
+)
+
+// the MPRIS properties of the playback settings that are restored
+var settingProperties = map[string]string{
+	model.SettingRate:    "Rate",
+	model.SettingVolume:  "Volume",
+	model.SettingLoop:    "LoopStatus",
+	model.SettingShuffle: "Shuffle",
+}
+
+func parseSettings(propertiesVariant map[string]dbus.Variant) map[string]string {
+	settings := map[string]string{}
+	for name, property := range settingProperties {
+		variant, found := propertiesVariant[property]
+		if !found {
+			continue
+		}
+		switch val := variant.Value().(type) {
+		case float64:
+			settings[name] = strconv.FormatFloat(val, 'g', -1, 64)
+		case string:
+			settings[name] = val
+		case bool:
+			settings[name] = strconv.FormatBool(val)
+		}
+	}
+	return settings
+}
+
+func settingVariant(name string, value string) (dbus.Variant, error) {
+	switch name {
+	case model.SettingRate, model.SettingVolume:
+		f, err := strconv.ParseFloat(value, 64)
+		return dbus.MakeVariant(f), err
+	case model.SettingShuffle:
+		b, err := strconv.ParseBool(value)
+		return dbus.MakeVariant(b), err
+	default:
+		return dbus.MakeVariant(value), nil
+	}
+}
+
+func (player *Player) syncSettings(properties *Properties) {
+	for name, value := range properties.Settings {
+		player.settings[name] = value
+	}
+}
+
+// rememberSettings records the settings the player has now for the bookmark.
+func (player *Player) rememberSettings() {
+	if player.Bookmark == nil {
+		return
+	}
+	for name, value := range player.settings {
+		player.Bookmark.RememberSetting(name, value)
+	}
+}
+
+// restoreSettings sets the playback settings of the bookmark in the player
+// except the ones that are configured not to be restored.
+func (player *Player) restoreSettings() {
+	if player.Bookmark == nil {
+		return
+	}
+
+	for _, setting := range player.Bookmark.Settings {
+		if !player.Cli.Policy.RestoresSetting(setting.Name) {
+			continue
+		}
+		property, ok := settingProperties[setting.Name]
+		if !ok {
+			continue
+		}
+		variant, err := settingVariant(setting.Name, setting.Value)
+		if err != nil {
+			log.Printf("[DEBUG] invalid %s setting: %+v", setting.Name, err)
+			continue
+		}
+
+		log.Printf("[DEBUG] restoring %s to %s", setting.Name, setting.Value)
+		err = player.MprisObj.Call("org.freedesktop.DBus.Properties.Set", dbus.FlagNoAutoStart,
+			"org.mpris.MediaPlayer2.Player", property, variant).Store()
+		if err != nil {
+			log.Printf("[DEBUG] could not restore %s: %+v", setting.Name, err)
+			continue
+		}
+
+		player.settings[setting.Name] = setting.Value
+		if rate, ok := variant.Value().(float64); ok && setting.Name == model.SettingRate && rate > 0 {
+			player.setRate(rate)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package player
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// How often the position is checked for segments to skip while playing.
+const skipCheckInterval = 250 * time.Millisecond
+
+func (player *Player) loadSegments() {
+	player.segments = nil
+	player.skipped = map[int]bool{}
+	player.unskipped = map[int]bool{}
+	player.skipFailed = map[int]bool{}
+
+	if player.Bookmark == nil {
+		return
+	}
+
+	segments, err := player.Bookmark.SkipSegments(player.DB)
+	if err != nil {
+		log.Printf("[DEBUG] could not load skip segments: %+v", err)
+		return
+	}
+	player.segments = segments
+	log.Printf("[DEBUG] found %d segments to skip", len(segments))
+}
+
+// checkSkip jumps past the segment the player is in unless it was unskipped.
+// A segment the player could not seek past plays until playback leaves it.
+func (player *Player) checkSkip() {
+	if player.Status != Playing || len(player.segments) == 0 || player.restoring() {
+		return
+	}
+
+	position := player.currentPosition()
+	for i, segment := range player.segments {
+		if !segment.Contains(position) {
+			// the unskip only lasts until playback leaves the segment
+			delete(player.unskipped, i)
+			delete(player.skipFailed, i)
+			continue
+		}
+		if player.unskipped[i] || player.skipFailed[i] {
+			continue
+		}
+
+		end := segment.End
+		if player.Length > 0 && end > player.Length {
+			end = player.Length
+		}
+		err := player.syncPosition(end)
+		if err != nil {
+			log.Printf("[DEBUG] could not skip segment: %+v", err)
+			fmt.Fprintf(os.Stderr, "playerbm: could not skip %s-%s\n", FormatPosition(segment.Start), FormatPosition(end))
+			player.skipFailed[i] = true
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "playerbm: skipping %s-%s\n", FormatPosition(segment.Start), FormatPosition(end))
+		player.skipped[i] = true
+		return
+	}
+}
+
+// unskip lets a segment play once when the user seeks back into a segment
+// that was skipped.
+func (player *Player) unskip(position int64) {
+	for i, segment := range player.segments {
+		if player.skipped[i] && segment.Contains(position) {
+			log.Printf("[DEBUG] seeked back into a skipped segment, playing it once")
+			player.unskipped[i] = true
+		}
+	}
+}
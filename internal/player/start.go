@@ -0,0 +1,86 @@
+package player
+
+import (
+	"fmt"
+	"github.com/altdesktop/playerbm/internal/model"
+	"github.com/kballard/go-shellquote"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// startFlags are the flags of players to start playing at a position in
+// seconds. Starting there avoids playing the start of the file before the
+// position is restored over MPRIS.
+var startFlags = map[string][]string{
+	"mpv":     {"--start=%s"},
+	"vlc":     {"--start-time=%s"},
+	"cvlc":    {"--start-time=%s"},
+	"mplayer": {"-ss", "%s"},
+	"ffplay":  {"-ss", "%s"},
+}
+
+// withStartFlag adds the flag to start at the position to the player command
+// if the player has one and the command opens the url.
+func withStartFlag(playerCmd string, url *model.XesamUrl, position int64) (string, bool) {
+	words, err := shellquote.Split(playerCmd)
+	if err != nil || len(words) == 0 {
+		return "", false
+	}
+
+	flags, ok := startFlags[filepath.Base(words[0])]
+	if !ok || urlArgIndex(words, url) == -1 {
+		return "", false
+	}
+
+	seconds := fmt.Sprintf("%.3f", float64(position)/1e+6)
+	cmd := []string{words[0]}
+	for _, flag := range flags {
+		cmd = append(cmd, strings.Replace(flag, "%s", seconds, 1))
+	}
+	cmd = append(cmd, words[1:]...)
+	return shellquote.Join(cmd...), true
+}
+
+// launchUrl is the url the player command opens if it opens one url.
+func (player *Player) launchUrl() *model.XesamUrl {
+	if player.Cli.ResumeUrl != nil {
+		return player.Cli.ResumeUrl
+	}
+	urls := commandUrls(player.Cli.PlayerCmd)
+	if len(urls) != 1 {
+		return nil
+	}
+	return urls[0]
+}
+
+// launchCmd is the command that runs the player. It starts the player at the
+// position of the bookmark when the player has a flag for that.
+func (player *Player) launchCmd() string {
+	url := player.launchUrl()
+	if url == nil {
+		return player.Cli.PlayerCmd
+	}
+
+	bookmark, err := model.GetBookmark(player.DB, url, player.Cli.Policy)
+	if err != nil || !bookmark.Exists() || bookmark.Finished == 1 {
+		return player.Cli.PlayerCmd
+	}
+
+	position := player.Cli.Policy.ResumePosition(bookmark, bookmark.Position, player.now())
+	if position <= 0 {
+		return player.Cli.PlayerCmd
+	}
+	if player.Cli.SectionStartFlag {
+		if i := bookmark.ChapterIndex(position); i != -1 {
+			position = bookmark.Chapters[i].Position
+		}
+	}
+
+	cmd, ok := withStartFlag(player.Cli.PlayerCmd, url, position)
+	if !ok {
+		return player.Cli.PlayerCmd
+	}
+	log.Printf("[DEBUG] starting the player at %s", FormatPosition(position))
+	return cmd
+}
@@ -0,0 +1,246 @@
+package player
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// A Supervisor manages any number of players on one bus connection. It routes
+// the signals of the bus to the players they are for and stops every player
+// when playerbm is interrupted so their bookmarks are saved.
+type Supervisor struct {
+	Bus     *dbus.Conn
+	signals chan *dbus.Signal
+	mu      sync.Mutex
+	routes  map[*Player]*route
+	wg      sync.WaitGroup
+	errs    []error
+	players []*Player
+}
+
+// A route is where the supervisor sends the signals of a player. A player is
+// launching until it has a bus name. A player that is detached keeps its bus
+// name but has no owner until it takes the name back.
+type route struct {
+	busName   string
+	owner     string
+	launching bool
+	queue     *signalQueue
+}
+
+// A signalQueue holds the signals for a player until it reads them, so a
+// player that is busy does not hold up the others or lose signals.
+type signalQueue struct {
+	mu      sync.Mutex
+	signals []*dbus.Signal
+	ready   chan struct{}
+	done    chan struct{}
+}
+
+func newSignalQueue(out chan<- *dbus.Signal) *signalQueue {
+	queue := &signalQueue{
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go queue.run(out)
+	return queue
+}
+
+func (queue *signalQueue) push(message *dbus.Signal) {
+	queue.mu.Lock()
+	queue.signals = append(queue.signals, message)
+	queue.mu.Unlock()
+	select {
+	case queue.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (queue *signalQueue) pop() *dbus.Signal {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if len(queue.signals) == 0 {
+		return nil
+	}
+	message := queue.signals[0]
+	queue.signals = queue.signals[1:]
+	return message
+}
+
+func (queue *signalQueue) run(out chan<- *dbus.Signal) {
+	for {
+		select {
+		case <-queue.ready:
+		case <-queue.done:
+			return
+		}
+		for message := queue.pop(); message != nil; message = queue.pop() {
+			select {
+			case out <- message:
+			case <-queue.done:
+				return
+			}
+		}
+	}
+}
+
+func (queue *signalQueue) close() {
+	close(queue.done)
+}
+
+func NewSupervisor(bus *dbus.Conn) (*Supervisor, error) {
+	supervisor := &Supervisor{
+		Bus:     bus,
+		signals: make(chan *dbus.Signal, 100),
+		routes:  map[*Player]*route{},
+	}
+
+	err := bus.AddMatchSignal(
+		dbus.WithMatchSender("org.freedesktop.DBus"),
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchObjectPath("/org/freedesktop/DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	bus.Signal(supervisor.signals)
+	go func() {
+		for message := range supervisor.signals {
+			supervisor.route(message)
+		}
+	}()
+
+	interrupts := make(chan os.Signal, 10)
+	signal.Notify(interrupts, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	go supervisor.handleInterrupts(interrupts)
+
+	return supervisor, nil
+}
+
+// Add puts the player under the supervisor so it gets its signals.
+func (supervisor *Supervisor) Add(player *Player) {
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+	player.supervisor = supervisor
+	supervisor.routes[player] = &route{
+		busName:   player.BusName,
+		owner:     player.NameOwner,
+		launching: len(player.BusName) == 0,
+		queue:     newSignalQueue(player.Signals),
+	}
+	supervisor.players = append(supervisor.players, player)
+}
+
+func (supervisor *Supervisor) remove(player *Player) {
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+	if r, ok := supervisor.routes[player]; ok {
+		r.queue.close()
+		delete(supervisor.routes, player)
+	}
+}
+
+func (supervisor *Supervisor) setRoute(player *Player, busName string, owner string) {
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+	if r, ok := supervisor.routes[player]; ok {
+		r.busName = busName
+		r.owner = owner
+		r.launching = len(busName) == 0
+	}
+}
+
+// route sends the signal to the player that sent it and changes of a name
+// owner to the player with the name. Players that are being launched get the
+// signals of the players that are not managed yet to find their player.
+func (supervisor *Supervisor) route(message *dbus.Signal) {
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+
+	var queues []*signalQueue
+	if message.Name == "org.freedesktop.DBus.NameOwnerChanged" && message.Sender == "org.freedesktop.DBus" {
+		name := ""
+		if len(message.Body) > 0 {
+			name = fmt.Sprintf("%s", message.Body[0])
+		}
+		for _, r := range supervisor.routes {
+			if r.busName == name || r.launching {
+				queues = append(queues, r.queue)
+			}
+		}
+	} else {
+		for _, r := range supervisor.routes {
+			if r.owner == message.Sender {
+				queues = append(queues, r.queue)
+			}
+		}
+		if len(queues) == 0 {
+			for _, r := range supervisor.routes {
+				if r.launching {
+					queues = append(queues, r.queue)
+				}
+			}
+		}
+	}
+
+	for _, queue := range queues {
+		queue.push(message)
+	}
+}
+
+// handleInterrupts asks every player to stop when playerbm is interrupted.
+func (supervisor *Supervisor) handleInterrupts(interrupts <-chan os.Signal) {
+	for s := range interrupts {
+		log.Printf("[DEBUG] got %s, stopping the players", s)
+		supervisor.mu.Lock()
+		for player := range supervisor.routes {
+			select {
+			case player.stop <- s:
+			default:
+				// the player is stopping already
+			}
+		}
+		supervisor.mu.Unlock()
+	}
+}
+
+// Go runs the player with the function in the background until it returns.
+func (supervisor *Supervisor) Go(player *Player, run func() error) {
+	supervisor.Add(player)
+	supervisor.wg.Add(1)
+	go func() {
+		defer supervisor.wg.Done()
+		err := run()
+		supervisor.remove(player)
+		if err != nil {
+			supervisor.mu.Lock()
+			supervisor.errs = append(supervisor.errs, err)
+			supervisor.mu.Unlock()
+		}
+	}()
+}
+
+// Wait waits for all the players to finish. It returns the first error and
+// the exit code of the first player that did not exit cleanly.
+func (supervisor *Supervisor) Wait() (int, error) {
+	supervisor.wg.Wait()
+
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+	if len(supervisor.errs) > 0 {
+		return 1, supervisor.errs[0]
+	}
+	for _, player := range supervisor.players {
+		if player.ExitCode != 0 {
+			return player.ExitCode, nil
+		}
+	}
+	return 0, nil
+}
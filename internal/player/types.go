@@ -5,6 +5,7 @@ import (
 	"github.com/altdesktop/playerbm/internal/cli"
 	"github.com/altdesktop/playerbm/internal/model"
 	"github.com/godbus/dbus/v5"
+	"os"
 	"os/exec"
 	"time"
 )
@@ -21,17 +22,62 @@ type Player struct {
 	Cli           *cli.PbmCli
 	Cmd           *exec.Cmd
 	Bookmark      *model.Bookmark
+	Session       *model.Session
 	BusName       string
 	NameOwner     string
 	MprisObj      dbus.BusObject
 	Position      int64
 	PositionTime  time.Time
+	Rate          float64
+	CanSeek       bool
 	TrackId       dbus.ObjectPath
 	Status        string
 	Length        int64
 	ProcessFinish chan error
 	Signals       chan *dbus.Signal
 	ExitCode      int
+	// requests of the supervisor to stop with the signal playerbm got
+	stop chan os.Signal
+	// properties that were got from the player in the background
+	updates chan *Properties
+	// the url of a file that finished but the next file was not opened
+	finishedUrl *model.XesamUrl
+	// whether the bookmark was in the queue when it was loaded
+	queued bool
+	// whether the position of the session is to be restored when the player
+	// goes to its track
+	restoreSession bool
+	// the segments to skip in the current file, which of them were skipped,
+	// which the user chose to play and which the player could not skip
+	segments   []model.Segment
+	skipped    map[int]bool
+	unskipped  map[int]bool
+	skipFailed map[int]bool
+	// whether the player is playing the bookmark since the listenStart
+	// position
+	listening   bool
+	listenStart int64
+	// the playback settings the player has by name
+	settings map[string]string
+	// whether the position is polled because the player does not send the
+	// Seeked signal, when to poll it next and when the Seeked signal is due
+	polling        bool
+	pollInterval   time.Duration
+	nextPoll       time.Time
+	seekedDeadline time.Time
+	// the name of the seek method that worked last
+	seekMethod string
+	// the position of the bookmark that is being restored
+	restore *restore
+	// whether the player lost its bus name while its process is running
+	detached bool
+	// the error of the process when it finished while the player was
+	// detached
+	processErr error
+	// the supervisor that routes the signals of the bus to the player
+	supervisor *Supervisor
+	// the clock for the position which tests replace
+	now func() time.Time
 }
 
 func New(cli *cli.PbmCli, db *sql.DB, bus *dbus.Conn) *Player {
@@ -42,7 +88,13 @@ func New(cli *cli.PbmCli, db *sql.DB, bus *dbus.Conn) *Player {
 		Status:        Stopped,
 		ProcessFinish: make(chan error),
 		Signals:       make(chan *dbus.Signal, 10),
+		stop:          make(chan os.Signal, 1),
+		updates:       make(chan *Properties, 10),
 		PositionTime:  time.Now(),
+		Rate:          1,
+		CanSeek:       true,
+		now:           time.Now,
+		settings:      map[string]string{},
 	}
 }
 
@@ -58,9 +110,17 @@ func (e *PlayerCmdError) Error() string {
 type Properties struct {
 	Position    int64
 	HasPosition bool
+	Rate        float64
+	HasRate     bool
+	CanSeek     bool
+	HasCanSeek  bool
+	Settings    map[string]string
 	Length      int64
 	HasLength   bool
 	Url         *model.XesamUrl
 	Status      string
 	TrackId     dbus.ObjectPath
+	Title       string
+	Artist      string
+	Album       string
 }
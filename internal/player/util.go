@@ -1,9 +1,11 @@
 package player
 
 import (
+	"errors"
 	"fmt"
 	"github.com/godbus/dbus/v5"
 	"github.com/mitchellh/go-ps"
+	"strconv"
 	"strings"
 )
 
@@ -37,6 +39,26 @@ func FormatPosition(ms int64) string {
 	}
 }
 
+// ParsePosition parses a position in the format of FormatPosition or a number
+// of seconds.
+func ParsePosition(position string) (int64, error) {
+	parts := strings.Split(position, ":")
+	if len(parts) > 3 {
+		return 0, errors.New(fmt.Sprintf("invalid position: %s", position))
+	}
+
+	var seconds float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 || (i > 0 && value >= 60) {
+			return 0, errors.New(fmt.Sprintf("invalid position: %s", position))
+		}
+		seconds = seconds*60 + value
+	}
+
+	return int64(seconds * 1e+6), nil
+}
+
 func ListPlayers(bus *dbus.Conn) ([]string, error) {
 	prefix := "org.mpris.MediaPlayer2."
 	players := []string{}
@@ -54,3 +76,10 @@ func ListPlayers(bus *dbus.Conn) ([]string, error) {
 
 	return players, nil
 }
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
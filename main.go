@@ -2,8 +2,10 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/altdesktop/playerbm/internal/cli"
+	"github.com/altdesktop/playerbm/internal/config"
 	"github.com/altdesktop/playerbm/internal/model"
 	"github.com/altdesktop/playerbm/internal/player"
 	"github.com/godbus/dbus/v5"
@@ -13,36 +15,49 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func handleListBookmarks(db *sql.DB) error {
-	bookmarks, err := model.ListBookmarks(db)
+// displayUrl is the url as it is shown to the user
+func displayUrl(url *model.XesamUrl) string {
+	// TODO update me for http scheme
+	quoted := url.ShellQuoted()
+
+	// this is nice for me
+	home := os.Getenv("HOME")
+	if home != "" && strings.HasPrefix(quoted, home) {
+		quoted = strings.Replace(quoted, home, "~", 1)
+	}
+
+	return quoted
+}
+
+func handleListBookmarks(db *sql.DB, tag string) error {
+	bookmarks, err := model.ListTaggedBookmarks(db, tag)
 	if err != nil {
 		return err
 	}
 
+	printBookmarks(bookmarks)
+	return nil
+}
+
+func printBookmarks(bookmarks []model.Bookmark) {
 	if len(bookmarks) == 0 {
 		// nothing to do
-		return nil
+		return
 	}
 
 	urls := []string{}
 
-	home := os.Getenv("HOME")
-
 	// get the longest url
 	maxUrlLen := 0
 	for _, b := range bookmarks {
-		// TODO update me for http scheme
-		quoted := b.Url.ShellQuoted()
-
-		// this is nice for me
-		if home != "" && strings.HasPrefix(quoted, home) {
-			quoted = strings.Replace(quoted, home, "~", 1)
-		}
+		quoted := displayUrl(b.Url)
 
 		l := len(quoted)
 		if l > maxUrlLen {
@@ -51,11 +66,27 @@ func handleListBookmarks(db *sql.DB) error {
 		urls = append(urls, quoted)
 	}
 
+	positions := []string{}
+	maxPositionLen := len("POSITION")
+	for _, b := range bookmarks {
+		positionFormatted := player.FormatPosition(b.Position)
+		if b.Length > 0 {
+			positionFormatted = positionFormatted + "/" + player.FormatPosition(b.Length)
+		}
+		if len(positionFormatted) > maxPositionLen {
+			maxPositionLen = len(positionFormatted)
+		}
+		positions = append(positions, positionFormatted)
+	}
+
 	urlFormat := "%-" + strconv.Itoa(maxUrlLen+2) + "v"
+	positionFormat := "%-" + strconv.Itoa(maxPositionLen+2) + "v"
 
 	fmt.Fprintf(os.Stderr, urlFormat, "URL")
 	fmt.Fprintf(os.Stderr, "%-9v", "SHA256")
-	fmt.Fprintf(os.Stderr, "POSITION")
+	fmt.Fprintf(os.Stderr, positionFormat, "POSITION")
+	fmt.Fprintf(os.Stderr, "%-7v", "HEARD")
+	fmt.Fprintf(os.Stderr, "CHAPTER")
 	fmt.Fprintf(os.Stderr, "\n")
 
 	for i, b := range bookmarks {
@@ -65,15 +96,15 @@ func handleListBookmarks(db *sql.DB) error {
 		} else {
 			fmt.Printf("%s", "         ")
 		}
-		positionFormatted := player.FormatPosition(b.Position)
-		if b.Length > 0 {
-			positionFormatted = positionFormatted + "/" + player.FormatPosition(b.Length)
+		fmt.Printf(positionFormat, positions[i])
+		if len(b.Listened) > 0 {
+			fmt.Printf("%-7v", fmt.Sprintf("%.0f%%", b.Coverage()))
+		} else {
+			fmt.Printf("%-7v", "-")
 		}
-		fmt.Printf(positionFormatted)
+		fmt.Printf("%s", formatChapter(&b, b.Position))
 		fmt.Printf("\n")
 	}
-
-	return nil
 }
 
 func setupLogging() {
@@ -98,6 +129,279 @@ func setupDBPath() (string, error) {
 	return path.Join(pathDir, "bookmarks.db"), nil
 }
 
+// loadPolicy builds the playback rules from the [dir PATH] sections of the
+// config file.
+func loadPolicy(conf *config.Config) (*model.Policy, error) {
+	policy := &model.Policy{}
+	home := os.Getenv("HOME")
+
+	for _, section := range conf.SectionsWithPrefix("dir") {
+		dir := section.Arg()
+		if home != "" && (dir == "~" || strings.HasPrefix(dir, "~/")) {
+			dir = home + dir[1:]
+		}
+		if !filepath.IsAbs(dir) {
+			return nil, errors.New(fmt.Sprintf("[%s]: the directory must be an absolute path", section.Name))
+		}
+
+		rule := model.PathRule{Prefix: filepath.Clean(dir)}
+		for key, value := range section.Values {
+			position, err := player.ParsePosition(value)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("[%s] %s: %s", section.Name, key, err))
+			}
+			switch key {
+			case "intro":
+				rule.StartOffset = position
+			case "outro":
+				rule.FinishThreshold = position
+			case "min-length":
+				rule.MinLength = position
+			default:
+				return nil, errors.New(fmt.Sprintf("[%s]: unknown key: %s", section.Name, key))
+			}
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+
+	finish := conf.Section("finish")
+	if finish != nil {
+		completion := &model.MediaTypeCompletion{}
+		for key, value := range finish.Values {
+			if key == "keep-position" {
+				policy.KeepFinishedPosition = value == "yes" || value == "true"
+				continue
+			}
+			rule, err := parseCompletion(value)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("[finish] %s: %s", key, err))
+			}
+			switch key {
+			case "default":
+				completion.Other = rule
+			case "audio":
+				completion.Audio = rule
+			case "video":
+				completion.Video = rule
+			default:
+				return nil, errors.New(fmt.Sprintf("[finish]: unknown key: %s", key))
+			}
+		}
+		if completion.Audio == nil {
+			completion.Audio = completion.Other
+		}
+		if completion.Video == nil {
+			completion.Video = completion.Other
+		}
+		policy.Completion = completion
+	}
+
+	resume := conf.Section("resume")
+	if resume != nil {
+		rewind := &model.RewindPolicy{}
+		for key, value := range resume.Values {
+			var err error
+			switch key {
+			case "rewind":
+				rewind.Min, err = player.ParsePosition(value)
+			case "rewind-max":
+				rewind.Max, err = player.ParsePosition(value)
+			case "rewind-max-after":
+				rewind.MaxAfter, err = parseDuration(value)
+			case "snap-chapter":
+				rewind.SnapChapter = value == "yes" || value == "true"
+			case "rewind-video":
+				rewind.SkipVideo = value == "no" || value == "false"
+			default:
+				err = errors.New(fmt.Sprintf("unknown key: %s", key))
+			}
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("[resume] %s: %s", key, err))
+			}
+		}
+		if rewind.MaxAfter == 0 {
+			rewind.MaxAfter = 7 * 24 * time.Hour
+		}
+		policy.Rewind = rewind
+	}
+
+	restore := conf.Section("restore")
+	if restore != nil {
+		for key, value := range restore.Values {
+			known := false
+			for _, name := range model.SettingNames {
+				known = known || name == key
+			}
+			if !known {
+				return nil, errors.New(fmt.Sprintf("[restore]: unknown setting: %s", key))
+			}
+			if value == "no" || value == "false" {
+				policy.NoRestore = append(policy.NoRestore, key)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// loadPlayers reads the player commands to resume with from the [players]
+// section of the config file.
+func loadPlayers(conf *config.Config) (player.DefaultPlayers, error) {
+	players := player.DefaultPlayers{}
+	section := conf.Section("players")
+	if section == nil {
+		return players, nil
+	}
+
+	for key, value := range section.Values {
+		err := player.CheckDefaultPlayerKey(key)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("[players]: %s", err))
+		}
+		if len(value) == 0 {
+			return nil, errors.New(fmt.Sprintf("[players] %s: the player command is empty", key))
+		}
+		players[key] = value
+	}
+
+	return players, nil
+}
+
+// parseDuration parses a duration like 12h or 7d.
+func parseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, errors.New(fmt.Sprintf("not a number of days: %s", value))
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// parseCompletion parses when a file is finished. That is a time from the end
+// like 0:10, a percent of the length like 95% or a percent of the file that
+// was listened to like heard 90%.
+func parseCompletion(value string) (model.CompletionPolicy, error) {
+	heard := strings.HasPrefix(value, "heard ")
+	value = strings.TrimSpace(strings.TrimPrefix(value, "heard "))
+
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, errors.New(fmt.Sprintf("not a percent: %s", value))
+		}
+		if heard {
+			return &model.CoverageCompletion{Percent: percent}, nil
+		}
+		return &model.PercentCompletion{Percent: percent}, nil
+	}
+
+	if heard {
+		return nil, errors.New(fmt.Sprintf("heard must be a percent, got: %s", value))
+	}
+	threshold, err := player.ParsePosition(value)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ThresholdCompletion{Threshold: threshold}, nil
+}
+
+// openTarget is the running player to open the resume url in. It is the
+// player named by the open-in flag, or else the running player that is the
+// player of the bookmark or the one configured for the url when it says it
+// supports the url. Player commands given with the player flag are always
+// launched.
+func openTarget(args *cli.PbmCli, db *sql.DB, bus *dbus.Conn, names []string, players player.DefaultPlayers) (string, bool) {
+	if len(args.OpenIn) > 0 {
+		return player.MatchPlayerName(names, args.OpenIn)
+	}
+	if len(args.Player) > 0 {
+		return "", false
+	}
+
+	program := player.CommandProgram(playerTemplate(args, db, players))
+	if len(program) == 0 {
+		return "", false
+	}
+	name, ok := player.MatchPlayerName(names, program)
+	if !ok {
+		return "", false
+	}
+
+	p := player.New(args, db, bus)
+	p.SetName(name)
+	supported, err := p.Supports(args.ResumeUrl)
+	if err != nil {
+		log.Printf("[DEBUG] could not get what player %s supports: %+v", name, err)
+		return "", false
+	}
+	return name, supported
+}
+
+func newSupervisor(bus *dbus.Conn) *player.Supervisor {
+	supervisor, err := player.NewSupervisor(bus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return supervisor
+}
+
+// supervise waits for the players of the supervisor to exit and then exits
+// with the exit code of the player that failed.
+func supervise(supervisor *player.Supervisor) {
+	exitCode, err := supervisor.Wait()
+	if err != nil {
+		if err, ok := err.(*player.PlayerCmdError); ok {
+			fmt.Printf("playerbm: %s\n", err.Error())
+			os.Exit(err.ExitCode)
+		}
+		fmt.Printf("playerbm: could not manage player: %s\n", err.Error())
+		os.Exit(1)
+	}
+	os.Exit(exitCode)
+}
+
+// playerTemplate is the player command template of the player that opened the
+// bookmark of the resume url last or else the player configured for its type.
+// It is empty when there is neither.
+func playerTemplate(args *cli.PbmCli, db *sql.DB, players player.DefaultPlayers) string {
+	bookmark, err := model.GetBookmark(db, args.ResumeUrl, args.Policy)
+	if err != nil {
+		log.Printf("[DEBUG] could not get the bookmark to resume: %+v", err)
+	} else if len(bookmark.PlayerCmd) > 0 {
+		log.Printf("[DEBUG] the player command of the bookmark is: %s", bookmark.PlayerCmd)
+		return bookmark.PlayerCmd
+	}
+
+	if template, ok := players.Cmd(args.ResumeUrl); ok {
+		log.Printf("[DEBUG] the configured player command is: %s", template)
+		return template
+	}
+
+	return ""
+}
+
+// resumeCmd is the command that opens the resume url. The player given with
+// the player flag comes first, then the player that opened the bookmark last,
+// then the player for its type from the config and then xdg-open. It is empty
+// when there is no player to open it with.
+func resumeCmd(args *cli.PbmCli, db *sql.DB, players player.DefaultPlayers) (string, error) {
+	if len(args.Player) > 0 {
+		return player.FillPlayerCmd(args.Player, args.ResumeUrl)
+	}
+
+	if template := playerTemplate(args, db, players); len(template) > 0 {
+		return player.FillPlayerCmd(template, args.ResumeUrl)
+	}
+
+	xdgOpen, err := exec.LookPath("xdg-open")
+	if err != nil {
+		return "", nil
+	}
+	return fmt.Sprintf("%s %s", xdgOpen, args.ResumeUrl.ShellQuoted()), nil
+}
+
 func main() {
 	setupLogging()
 
@@ -120,6 +424,19 @@ func main() {
 		os.Exit(0)
 	}
 
+	var players player.DefaultPlayers
+	conf, err := config.Load(config.Path())
+	if err == nil {
+		args.Policy, err = loadPolicy(conf)
+	}
+	if err == nil {
+		players, err = loadPlayers(conf)
+	}
+	if err != nil {
+		fmt.Printf("playerbm: config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
 	dbPath, err := setupDBPath()
 	if err != nil {
 		log.Fatal(err)
@@ -132,8 +449,20 @@ func main() {
 	defer db.Close()
 
 	if args.ListBookmarksFlag {
-		err = handleListBookmarks(db)
+		err = handleListBookmarks(db, args.Tag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if len(args.Command) > 0 {
+		err = runCommand(args, db)
 		if err != nil {
+			if cmdErr, ok := err.(*CommandError); ok {
+				fmt.Printf("playerbm: %s\n", cmdErr.Error())
+				os.Exit(1)
+			}
 			log.Fatal(err)
 		}
 		os.Exit(0)
@@ -173,22 +502,45 @@ func main() {
 	if args.ResumeFlag {
 		var err error
 
-		xdgOpen, err := exec.LookPath("xdg-open")
-		if err != nil {
-			fmt.Printf("playerbm: resuming requires xdg-open to be in the PATH (provided by xdg-utils)\n")
-			os.Exit(127)
-		}
-
 		if args.ResumeUrl == nil {
-			bookmark, err := model.GetMostRecentBookmark(db)
+			bookmark, err := model.GetMostRecentTaggedBookmark(db, args.Tag)
 			if err != nil {
 				log.Fatal(err)
 			}
-			if bookmark == nil {
+			if bookmark != nil {
+				args.ResumeUrl = bookmark.Url
+			} else if len(args.Tag) == 0 {
+				// go on to the next thing in the queue
+				args.ResumeUrl, err = model.QueueHead(db)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			if args.ResumeUrl == nil {
 				fmt.Fprintf(os.Stderr, "No recent unfinished bookmarks found\n")
 				os.Exit(0)
 			}
-			args.ResumeUrl = bookmark.Url
+		}
+
+		if args.ResumeUrl.Scheme() == "file" {
+			dir, err := filepath.Abs(args.ResumeUrl.UnescapedPath())
+			if err != nil {
+				log.Fatal(err)
+			}
+			if stat, err := os.Stat(dir); err == nil && stat.IsDir() {
+				// resume the book in the directory
+				book, err := model.GetBook(db, dir)
+				if err != nil {
+					log.Fatal(err)
+				}
+				file := book.CurrentFile()
+				if file == nil {
+					fmt.Fprintf(os.Stderr, "No unfinished media files found in %s\n", dir)
+					os.Exit(0)
+				}
+				log.Printf("[DEBUG] resuming file %d of the book in %s", book.Current+1, dir)
+				args.ResumeUrl = file.Url
+			}
 		}
 
 		names, err := player.ListPlayers(bus)
@@ -212,20 +564,66 @@ func main() {
 					log.Printf("[WARNING] could not load bookmark for player: %s", name)
 					continue
 				}
-				err = p.Manage()
-				if err != nil {
-					fmt.Printf("playerbm: could not manage player: %s\n", err.Error())
-					os.Exit(1)
-				}
-				os.Exit(p.ExitCode)
+				supervisor := newSupervisor(bus)
+				supervisor.Go(p, p.Manage)
+				supervise(supervisor)
+			}
+		}
+
+		name, ok := openTarget(args, db, bus, names, players)
+		if !ok && len(args.OpenIn) > 0 {
+			fmt.Printf("playerbm: no running player named %s\n", args.OpenIn)
+			os.Exit(1)
+		}
+		if ok {
+			p := player.New(args, db, bus)
+			p.SetName(name)
+			err = p.OpenUri(args.ResumeUrl)
+			if err != nil {
+				fmt.Printf("playerbm: could not open %s in %s: %s\n", displayUrl(args.ResumeUrl), name, err.Error())
+				os.Exit(1)
 			}
+			supervisor := newSupervisor(bus)
+			supervisor.Go(p, p.Manage)
+			supervise(supervisor)
+		}
+
+		args.PlayerCmd, err = resumeCmd(args, db, players)
+		if err != nil {
+			fmt.Printf("playerbm: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if len(args.PlayerCmd) == 0 {
+			fmt.Printf("playerbm: no player to resume %s: add one to the [players] section of the config or install xdg-open (provided by xdg-utils)\n", displayUrl(args.ResumeUrl))
+			os.Exit(127)
 		}
+	}
 
-		quoted := args.ResumeUrl.ShellQuoted()
+	if args.AttachFlag {
+		names, err := player.ListPlayers(bus)
 		if err != nil {
 			log.Fatal(err)
 		}
-		args.PlayerCmd = fmt.Sprintf("%s %s", xdgOpen, quoted)
+
+		supervisor := newSupervisor(bus)
+		for _, attachName := range strings.Split(args.AttachPlayer, ",") {
+			attachName = strings.TrimSpace(attachName)
+			name, ok := player.MatchPlayerName(names, attachName)
+			if !ok {
+				fmt.Printf("playerbm: no running player named %s\n", attachName)
+				os.Exit(1)
+			}
+
+			p := player.New(args, db, bus)
+			p.SetName(name)
+			err = p.Attach()
+			if err != nil {
+				fmt.Printf("playerbm: could not attach to player %s: %s\n", name, err.Error())
+				os.Exit(1)
+			}
+			supervisor.Go(p, p.Manage)
+		}
+		supervise(supervisor)
 	}
 
 	if args.ListPlayersFlag {
@@ -297,16 +695,8 @@ func main() {
 		os.Exit(0)
 	}
 
+	supervisor := newSupervisor(bus)
 	p := player.New(args, db, bus)
-	err = p.RunCmd()
-	if err != nil {
-		if err, ok := err.(*player.PlayerCmdError); ok {
-			fmt.Printf("playerbm: %s\n", err.Error())
-			os.Exit(err.ExitCode)
-		}
-
-		log.Fatal(err)
-	}
-
-	os.Exit(p.ExitCode)
+	supervisor.Go(p, p.RunCmd)
+	supervise(supervisor)
 }